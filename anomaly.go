@@ -0,0 +1,161 @@
+package esqrunner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// AnomalyConfig is the configuration of the anomaly detection of a metric.
+// The methods are:
+//
+// - zscore: the distance of a value from the mean of the trailing window,
+// in standard deviations
+// - mad: the modified z-score, i.e. the distance of a value from the median
+// of the trailing window, in median absolute deviations, scaled by 0.6745
+// - seasonal: the distance of a value from the mean of the values of the
+// same weekday in the trailing window of weeks, in standard deviations
+//
+// The window is the number of the preceding periods, or weeks with seasonal
+// method, and defaults to 7, or 4 weeks. A point is flagged when the
+// absolute score reaches the threshold, which defaults to 3, or 3.5 with
+// mad method.
+type AnomalyConfig struct {
+	Method    string  `json:"method" yaml:"method"`
+	Window    int     `json:"window,omitempty" yaml:"window"`
+	Threshold float64 `json:"threshold,omitempty" yaml:"threshold"`
+}
+
+// PointAnomaly describes the anomaly of a point: the expected value, i.e.
+// the mean or the median of the window, and the score of the value.
+type PointAnomaly struct {
+	Method   string  `json:"method"`
+	Baseline float64 `json:"baseline"`
+	Score    float64 `json:"score"`
+}
+
+// Validate validates AnomalyConfig.
+func (c *AnomalyConfig) Validate() error {
+	switch c.Method {
+	case "zscore", "mad":
+		if c.Window == 0 {
+			c.Window = 7
+		}
+	case "seasonal":
+		if c.Window == 0 {
+			c.Window = 4
+		}
+	default:
+		return fmt.Errorf("anomaly detection method is unsupported: %s", c.Method)
+	}
+	if c.Window < 2 {
+		return fmt.Errorf("anomaly detection window must be at least 2: %d", c.Window)
+	}
+	if c.Threshold == 0 {
+		c.Threshold = 3
+		if c.Method == "mad" {
+			c.Threshold = 3.5
+		}
+	}
+	if c.Threshold < 0 {
+		return fmt.Errorf("anomaly detection threshold must be positive: %v", c.Threshold)
+	}
+	return nil
+}
+
+// validateAnomalyTransforms validates the transformations of a metric with
+// seasonal anomaly detection. The rolled up periods are not days, and the
+// weekdays of their starts are not comparable.
+func validateAnomalyTransforms(transforms []*TransformConfig) error {
+	if hasRollup(transforms) {
+		return fmt.Errorf("transform rollup is not supported by seasonal anomaly detection")
+	}
+	return nil
+}
+
+// detectAnomalies flags the anomalous points of the series. The points
+// without values, or with filled values, are not flagged, and are left out
+// of the windows. A point is not scored when
+// its window has less than two values, or no deviation.
+func detectAnomalies(points []*MetricPoint, c *AnomalyConfig) {
+	if c == nil {
+		return
+	}
+	for i, p := range points {
+		if p.Value == nil || p.Filled {
+			continue
+		}
+		window := []float64{}
+		switch c.Method {
+		case "seasonal":
+			weekday := p.Period.Start.Weekday()
+			for j := i - 1; j >= 0 && len(window) < c.Window; j-- {
+				if points[j].Value != nil && !points[j].Filled && points[j].Period.Start.Weekday() == weekday {
+					window = append(window, *points[j].Value)
+				}
+			}
+		default:
+			for j := i - c.Window; j < i; j++ {
+				if j >= 0 && points[j].Value != nil && !points[j].Filled {
+					window = append(window, *points[j].Value)
+				}
+			}
+		}
+		if len(window) < 2 {
+			continue
+		}
+		var baseline, deviation float64
+		switch c.Method {
+		case "mad":
+			baseline = median(window)
+			deviations := []float64{}
+			for _, v := range window {
+				deviations = append(deviations, math.Abs(v-baseline))
+			}
+			deviation = median(deviations) / 0.6745
+		default:
+			for _, v := range window {
+				baseline += v
+			}
+			baseline /= float64(len(window))
+			for _, v := range window {
+				deviation += (v - baseline) * (v - baseline)
+			}
+			deviation = math.Sqrt(deviation / float64(len(window)))
+		}
+		if deviation == 0 {
+			continue
+		}
+		score := (*p.Value - baseline) / deviation
+		if math.Abs(score) >= c.Threshold {
+			p.Anomaly = &PointAnomaly{Method: c.Method, Baseline: baseline, Score: score}
+		}
+	}
+}
+
+// median returns the median of the values.
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// hasAnomalyDetection returns true when any metric has anomaly detection.
+func (r *QueryRunner) hasAnomalyDetection() bool {
+	for _, m := range r.Config.Metrics {
+		if !m.Disabled && m.Anomaly != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// anomalyText returns the description of the anomaly in tabular outputs,
+// e.g. score 4.2, baseline 10.
+func anomalyText(a *PointAnomaly) string {
+	return fmt.Sprintf("score %s, baseline %s", formatValue(math.Round(a.Score*100)/100), formatValue(math.Round(a.Baseline*100)/100))
+}
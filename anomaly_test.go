@@ -0,0 +1,174 @@
+package esqrunner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnomalyDetection(t *testing.T) {
+	// 2020-03-02 is Monday, and the series peaks on Mondays.
+	start := time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)
+	weekly := []interface{}{100.0, 10.0, 12.0, 11.0, 9.0, 10.0, 11.0, 110.0, 10.0, 12.0, 11.0, 9.0, 10.0, 11.0, 105.0, 10.0, 12.0, 11.0, 9.0, 10.0, 11.0, 20.0}
+	testcases := []struct {
+		name    string
+		config  *AnomalyConfig
+		values  []interface{}
+		flagged []int
+	}{
+		{
+			name:    "zscore flags spike",
+			config:  &AnomalyConfig{Method: "zscore"},
+			values:  []interface{}{10.0, 11.0, 10.0, 9.0, 12.0, 10.0, 11.0, 40.0, 10.0},
+			flagged: []int{7},
+		},
+		{
+			name:    "mad flags drop",
+			config:  &AnomalyConfig{Method: "mad", Window: 5},
+			values:  []interface{}{10.0, 11.0, 9.0, 10.0, 12.0, 1.0, 10.0, "err"},
+			flagged: []int{5},
+		},
+		{
+			name:    "zscore with weekly peaks in window",
+			config:  &AnomalyConfig{Method: "zscore"},
+			values:  weekly,
+			flagged: []int{},
+		},
+		{
+			name:    "seasonal flags low monday",
+			config:  &AnomalyConfig{Method: "seasonal", Window: 2},
+			values:  weekly,
+			flagged: []int{21},
+		},
+	}
+	for _, tc := range testcases {
+		if err := tc.config.Validate(); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		points := testTransformPoints(start, tc.values...)
+		detectAnomalies(points, tc.config)
+		flagged := []int{}
+		for i, p := range points {
+			if p.Anomaly != nil {
+				flagged = append(flagged, i)
+			}
+		}
+		if len(flagged) != len(tc.flagged) {
+			t.Fatalf("%s: unexpected anomalies at %v, expected %v", tc.name, flagged, tc.flagged)
+		}
+		for i := range flagged {
+			if flagged[i] != tc.flagged[i] {
+				t.Fatalf("%s: unexpected anomalies at %v, expected %v", tc.name, flagged, tc.flagged)
+			}
+		}
+	}
+
+	// The filled values are left out of the windows.
+	points := testTransformPoints(start, 10.0, 11.0, 10.0, 9.0, 1000.0, 12.0, 10.0, 11.0, 40.0)
+	points[4].Filled = true
+	detectAnomalies(points, &AnomalyConfig{Method: "zscore", Window: 7, Threshold: 3})
+	if points[4].Anomaly != nil || points[8].Anomaly == nil {
+		t.Fatalf("unexpected anomalies with filled value in window: %+v, %+v", points[4].Anomaly, points[8].Anomaly)
+	}
+
+	for _, c := range []*AnomalyConfig{
+		{},
+		{Method: "ewma"},
+		{Method: "zscore", Window: 1},
+		{Method: "mad", Threshold: -1},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected anomaly config %+v to fail validation", c)
+		}
+	}
+}
+
+func TestAnomalyTransforms(t *testing.T) {
+	if err := validateAnomalyTransforms([]*TransformConfig{{MovingAverage: 7}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateAnomalyTransforms([]*TransformConfig{{CumulativeSum: true}, {Rollup: "week"}}); err == nil {
+		t.Fatalf("expected rollup with seasonal anomaly detection to fail validation")
+	}
+}
+
+func TestOutputAnomalies(t *testing.T) {
+	r := newTestOutputRunner(t)
+	m := r.Config.Metrics[0]
+	m.Anomaly = &AnomalyConfig{Method: "zscore", Window: 3}
+	if err := m.Anomaly.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r.Config.Timestamps = dailyTimestamps(r.Config.Timestamps[0], r.Config.Timestamps[0].AddDate(0, 0, 4))
+	r.Metrics[m.ID] = []uint64{10, 12, 11, 50, 11}
+	r.MetricErrors[m.ID] = []error{nil, nil, nil, nil, nil}
+
+	r.Config.Output.Format = "json"
+	out, err := r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal([]byte(out), report); err != nil {
+		t.Fatal(err)
+	}
+	a := report.Metrics[0].Points[3].Anomaly
+	if a == nil || a.Method != "zscore" || a.Baseline != 11 || a.Score < 3 {
+		t.Fatalf("unexpected anomaly: %+v\n%s", a, out)
+	}
+
+	r.Config.Output.Format = "csv"
+	for _, landscape := range []bool{true, false} {
+		r.Config.Output.Landscape = landscape
+		out, err = r.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr := csv.NewReader(strings.NewReader(out))
+		cr.Comma = ';'
+		records, err := cr.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if landscape {
+			if records[1][len(records[1])-2] != "2020/03/04: score 47.77, baseline 11" {
+				t.Fatalf("unexpected anomalies column: %v", records[1])
+			}
+			continue
+		}
+		if strings.Join(records[0][2:5], ",") != "Anomaly,Anomaly Baseline,Anomaly Score" || records[4][2] != "yes" || records[4][3] != "11.00" || records[3][2] != "" {
+			t.Fatalf("unexpected anomaly columns: %v", records)
+		}
+	}
+
+	r.Config.Output.Format = "html"
+	if out, err = r.Output(); err != nil || !strings.Contains(out, `<td class="anomaly" title="zscore score 47.77, baseline 11">50</td>`) {
+		t.Fatalf("html output has no anomaly: %v\n%s", err, out)
+	}
+	r.Config.Output.Format = "markdown"
+	if out, err = r.Output(); err != nil || !strings.Contains(out, "| **50** |") {
+		t.Fatalf("markdown output has no anomaly: %v\n%s", err, out)
+	}
+	r.Config.Output.Format = "xlsx"
+	if out, err = r.Output(); err != nil {
+		t.Fatal(err)
+	}
+	if sheet := xlsxFile(t, out, "xl/worksheets/sheet2.xml"); !strings.Contains(sheet, ">Anomalies<") || !strings.Contains(sheet, ">2020-03-04: score 47.77, baseline 11<") {
+		t.Fatalf("xlsx output has no anomaly: %s", sheet)
+	}
+
+	r.Config.Output.Format = "prometheus"
+	r.Config.Output.Timestamps = true
+	if out, err = r.Output(); err != nil || !strings.Contains(out, `,anomaly="true"} 50 1583280000000`) || strings.Count(out, "anomaly") != 1 {
+		t.Fatalf("prometheus output has no anomaly: %v\n%s", err, out)
+	}
+	r.Config.Output.Timestamps = false
+	var sb strings.Builder
+	r.outputInflux(&sb, nil)
+	lines := strings.Split(sb.String(), "\n")
+	if !strings.Contains(lines[3], " value=50,anomaly=true,anomaly_baseline=11,anomaly_score=47.76") || !strings.Contains(lines[4], " value=11,anomaly=false ") {
+		t.Fatalf("influx output has no anomaly: %s", sb.String())
+	}
+}
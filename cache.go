@@ -0,0 +1,158 @@
+package esqrunner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const cacheFileName = "esqrunner.cache.json"
+
+// CacheConfig is the configuration of the persistent result cache.
+type CacheConfig struct {
+	Dir          string `json:"dir" yaml:"dir"`
+	SettleWindow string `json:"settle_window" yaml:"settle_window"`
+	Disabled     bool   `json:"-" yaml:"-"`
+	Refresh      bool   `json:"-" yaml:"-"`
+	settleWindow time.Duration
+}
+
+// Validate validates CacheConfig.
+func (c *CacheConfig) Validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("cache config has no directory")
+	}
+	if c.SettleWindow == "" {
+		c.SettleWindow = "48h"
+	}
+	d, err := time.ParseDuration(c.SettleWindow)
+	if err != nil {
+		return fmt.Errorf("cache config has invalid settle window: %s", err)
+	}
+	if d < 0 {
+		return fmt.Errorf("cache config has negative settle window: %s", c.SettleWindow)
+	}
+	c.settleWindow = d
+	log.Debugf("cache directory: %s, settle window: %s", c.Dir, c.settleWindow)
+	return nil
+}
+
+// Settled returns true when the daily period starting at the provided
+// timestamp closed longer than the settle window ago.
+func (c *CacheConfig) Settled(ts, now time.Time) bool {
+	return periodSettled(ts, now, c.settleWindow)
+}
+
+func periodSettled(ts, now time.Time, window time.Duration) bool {
+	start := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+	end := start.AddDate(0, 0, 1)
+	return end.Add(window).Before(now)
+}
+
+// CacheEntry is a cached query result.
+type CacheEntry struct {
+	Total    uint64    `json:"total"`
+	CachedAt time.Time `json:"cached_at"`
+}
+
+// ResultCache is an on-disk cache of query results, stored in
+// a single file.
+type ResultCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*CacheEntry
+	dirty   bool
+}
+
+// OpenResultCache returns ResultCache stored in the provided directory.
+func OpenResultCache(dir string) (*ResultCache, error) {
+	dir, err := expandHomePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed creating cache directory %s: %s", dir, err)
+	}
+	c := &ResultCache{
+		path:    filepath.Join(dir, cacheFileName),
+		entries: make(map[string]*CacheEntry),
+	}
+	content, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &c.entries); err != nil {
+		return nil, fmt.Errorf("failed parsing cache file %s: %s", c.path, err)
+	}
+	log.Debugf("loaded %d cache entries from %s", len(c.entries), c.path)
+	return c, nil
+}
+
+// Get returns cached result.
+func (c *ResultCache) Get(key string) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, exists := c.entries[key]
+	if !exists {
+		return 0, false
+	}
+	return entry.Total, true
+}
+
+// Put adds a result to the cache.
+func (c *ResultCache) Put(key string, total uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &CacheEntry{Total: total, CachedAt: time.Now().UTC()}
+	c.dirty = true
+}
+
+// Close saves the cache to disk.
+func (c *ResultCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	log.Debugf("saved %d cache entries to %s", len(c.entries), c.path)
+	return nil
+}
+
+// cacheKey returns the key for a result of a metric query against an
+// index of a cluster for a period.
+func cacheKey(cluster string, m *Metric, index string, ts time.Time) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s", cluster, m.ID, metricQueryHash(m), index, ts.Format("2006-01-02"))
+}
+
+// metricQueryHash returns the hash of the normalized query of a metric.
+func metricQueryHash(m *Metric) string {
+	var query []byte
+	if m.Query != nil {
+		query = []byte(*m.Query)
+	}
+	h := sha256.New()
+	h.Write([]byte(normalizeBody(query)))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,36 @@
+package esqrunner
+
+import (
+	"testing"
+)
+
+func TestResultCache(t *testing.T) {
+	counts := map[string]uint64{
+		"tickets-20200301": 10,
+		"tickets-20200302": 20,
+	}
+	srv := newTestElasticsearch(t, counts)
+	defer srv.Close()
+	dir := t.TempDir()
+
+	for i, expHits := range []int{0, 2} {
+		r := newTestRunner(t, srv.URL)
+		r.Config.Cache = &CacheConfig{Dir: dir}
+		if err := r.Run(); err != nil {
+			t.Fatalf("run %d failed: %s", i, err)
+		}
+		if r.Summary.CacheHits != expHits {
+			t.Fatalf("run %d: expected %d cache hits, received: %d", i, expHits, r.Summary.CacheHits)
+		}
+	}
+
+	counts["tickets-20200301"] = 15
+	r := newTestRunner(t, srv.URL)
+	r.Config.Cache = &CacheConfig{Dir: dir, Refresh: true}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Summary.CacheHits != 0 || r.Metrics["28e3c0fb594443fea16131c5f26eeb81"][0] != 15 {
+		t.Fatalf("expected refreshed results, summary: %s", r.Summary)
+	}
+}
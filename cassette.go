@@ -0,0 +1,184 @@
+package esqrunner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CassetteInteraction is a single recorded request and response
+// exchanged with Elasticsearch.
+type CassetteInteraction struct {
+	Method       string              `json:"method"`
+	Index        string              `json:"index"`
+	Path         string              `json:"path"`
+	RequestBody  string              `json:"request_body"`
+	StatusCode   int                 `json:"status_code"`
+	Header       map[string][]string `json:"header"`
+	ResponseBody string              `json:"response_body"`
+}
+
+// CassetteRecorder is an http.RoundTripper saving every request and
+// response passing through it into a directory.
+type CassetteRecorder struct {
+	dir       string
+	transport http.RoundTripper
+}
+
+// CassettePlayer is an http.RoundTripper serving the responses previously
+// saved by CassetteRecorder without network access.
+type CassettePlayer struct {
+	dir string
+}
+
+// NewCassetteRecorder returns an instance of CassetteRecorder.
+func NewCassetteRecorder(dir string, transport http.RoundTripper) (*CassetteRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed creating cassette directory %s: %s", dir, err)
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &CassetteRecorder{dir: dir, transport: transport}, nil
+}
+
+// NewCassettePlayer returns an instance of CassettePlayer.
+func NewCassettePlayer(dir string) (*CassettePlayer, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening cassette directory %s: %s", dir, err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("cassette path %s is not a directory", dir)
+	}
+	return &CassettePlayer{dir: dir}, nil
+}
+
+// RoundTrip sends the request upstream and saves the exchange.
+func (c *CassetteRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &CassetteInteraction{
+		Method:       req.Method,
+		Index:        cassetteIndex(req.URL.Path),
+		Path:         req.URL.Path,
+		RequestBody:  string(reqBody),
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		ResponseBody: string(respBody),
+	}
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	fp := filepath.Join(c.dir, cassetteKey(req.Method, interaction.Index, reqBody)+".json")
+	if err := writeToFile(fp, string(data)); err != nil {
+		return nil, fmt.Errorf("failed recording cassette %s: %s", fp, err)
+	}
+	log.Debugf("recorded %s %s to %s", req.Method, req.URL.Path, fp)
+	return resp, nil
+}
+
+// RoundTrip returns the recorded response matching the request.
+func (c *CassettePlayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	index := cassetteIndex(req.URL.Path)
+	fp := filepath.Join(c.dir, cassetteKey(req.Method, index, reqBody)+".json")
+	content, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"no recorded interaction for %s %s, index: %s, cassette: %s",
+			req.Method, req.URL.Path, index, fp,
+		)
+	}
+	interaction := &CassetteInteraction{}
+	if err := json.Unmarshal(content, interaction); err != nil {
+		return nil, fmt.Errorf("failed parsing cassette %s: %s", fp, err)
+	}
+	log.Debugf("replayed %s %s from %s", req.Method, req.URL.Path, fp)
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(interaction.Header),
+		Body:          ioutil.NopCloser(strings.NewReader(interaction.ResponseBody)),
+		ContentLength: int64(len(interaction.ResponseBody)),
+		Request:       req,
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	return resp, nil
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return []byte{}, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// cassetteIndex returns the index the request targets, i.e. the first
+// path element unless it is an API endpoint, e.g. _cluster.
+func cassetteIndex(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		path = path[:i]
+	}
+	if strings.HasPrefix(path, "_") {
+		return ""
+	}
+	return path
+}
+
+// normalizeBody returns compact JSON with sorted keys, so that
+// whitespace and key order do not affect request matching.
+func normalizeBody(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return strings.TrimSpace(string(body))
+	}
+	return string(b)
+}
+
+func cassetteKey(method, index string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + "\n" + index + "\n" + normalizeBody(body)))
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
@@ -0,0 +1,88 @@
+package esqrunner
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestElasticsearch returns a stand-in for Elasticsearch answering
+// info and count requests. The counts are keyed by index name.
+func newTestElasticsearch(t *testing.T, counts map[string]uint64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/" {
+			fmt.Fprintf(w, `{"cluster_name":"test","cluster_uuid":"test-uuid","version":{"number":"7.17.10","build_flavor":"default"},"tagline":"You Know, for Search"}`)
+			return
+		}
+		if strings.HasSuffix(req.URL.Path, "/_count") {
+			index := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")[0]
+			if count, exists := counts[index]; exists {
+				fmt.Fprintf(w, `{"count":%d}`, count)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":{"type":"index_not_found_exception"},"status":404}`)
+			return
+		}
+		t.Logf("unexpected request: %s %s", req.Method, req.URL.Path)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+}
+
+func newTestRunner(t *testing.T, addr string) *QueryRunner {
+	r := New()
+	if err := r.ReadInConfig("assets/conf/default.yaml"); err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+	r.Config.Elasticsearch.Address = []string{addr}
+	for i := 0; i < 3; i++ {
+		r.Config.Timestamps = append(r.Config.Timestamps, time.Date(2020, time.March, 1+i, 0, 0, 0, 0, time.UTC))
+	}
+	return r
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	counts := map[string]uint64{
+		"tickets-20200301": 10,
+		"tickets-20200302": 20,
+	}
+	srv := newTestElasticsearch(t, counts)
+	dir := t.TempDir()
+
+	recorder := newTestRunner(t, srv.URL)
+	recorder.Config.Elasticsearch.RecordDir = dir
+	if err := recorder.Run(); err != nil {
+		t.Fatalf("error running with recorder: %s", err)
+	}
+	srv.Close()
+
+	player := newTestRunner(t, srv.URL)
+	player.Config.Elasticsearch.ReplayDir = dir
+	if err := player.Run(); err != nil {
+		t.Fatalf("error running with player: %s", err)
+	}
+
+	id := "28e3c0fb594443fea16131c5f26eeb81"
+	expected := []uint64{10, 20, 0}
+	for i, v := range expected {
+		if player.Metrics[id][i] != v {
+			t.Fatalf("replayed value mismatch at %d, expected: %d, received: %d", i, v, player.Metrics[id][i])
+		}
+	}
+	if player.MetricErrors[id][2] == nil {
+		t.Fatalf("expected replayed error for missing index")
+	}
+}
+
+func TestCassetteNormalizeBody(t *testing.T) {
+	a := cassetteKey("GET", "tickets-20200301", []byte(`{"query": {"match_all": {}}, "size": 0}`))
+	b := cassetteKey("GET", "tickets-20200301", []byte("{\"size\":0,\n \"query\":{\"match_all\":{}}}"))
+	if a != b {
+		t.Fatalf("expected equal keys for equivalent bodies, received: %s, %s", a, b)
+	}
+}
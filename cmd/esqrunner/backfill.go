@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/greenpau/esqrunner"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"time"
+)
+
+func runBackfill(args []string) {
+	var configFile string
+	var logLevel string
+	var fromDate, toDate string
+	var chunkSize int
+	client := esqrunner.New()
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fs.StringVar(&configFile, "config", "", "path to configuration file")
+	fs.StringVar(&logLevel, "log-level", "info", "logging severity level")
+	fs.StringVar(&fromDate, "from", "", "first date to backfill, e.g. 2020-01-01")
+	fs.StringVar(&toDate, "to", "", "last date to backfill, e.g. 2020-01-31")
+	fs.IntVar(&chunkSize, "chunk", 7, "number of days queried per chunk")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n%s backfill - fill gaps in metric history\n\n", app.Name)
+		fmt.Fprintf(os.Stderr, "Usage: %s backfill [arguments]\n\n", app.Name)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nDocumentation: %s\n\n", app.Documentation)
+	}
+	fs.Parse(args)
+
+	if level, err := log.ParseLevel(logLevel); err == nil {
+		log.SetLevel(level)
+	} else {
+		log.Fatalf("%s", err.Error())
+	}
+
+	if configFile == "" {
+		log.Fatalf("no configuration file")
+	}
+
+	from, err := time.ParseInLocation("2006-01-02", fromDate, time.Local)
+	if err != nil {
+		log.Fatalf("invalid from date: %s", err)
+	}
+	to, err := time.ParseInLocation("2006-01-02", toDate, time.Local)
+	if err != nil {
+		log.Fatalf("invalid to date: %s", err)
+	}
+
+	if err := client.ReadInConfig(configFile); err != nil {
+		log.Fatalf("error reading configuration file, %s", err)
+	}
+
+	if err := client.Backfill(from, to, chunkSize); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
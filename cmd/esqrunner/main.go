@@ -7,6 +7,8 @@ import (
 	"github.com/greenpau/versioned"
 	log "github.com/sirupsen/logrus"
 	"os"
+	"strconv"
+	"strings"
 )
 
 var (
@@ -34,24 +36,54 @@ func main() {
 	var logLevel string
 	var isShowVersion bool
 	var isValidate bool
-	var datePicker string
+	var datePicker, comparePicker string
 	var isLandscape bool
-	var outputDir, outputFilePrefix, outputFormat string
+	var outputDir, outputFilePrefix, outputFormat, outputTemplate string
+	var recordDir, replayDir string
+	var isNoCache, isRefreshCache bool
+	var isFromHistory bool
+	var tableWidth int
+	var isNoColor bool
+	var sortBy, pivotRows, pivotColumns, pivotDate string
+	var isSubtotals bool
+	var isTimestamps bool
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		runBackfill(os.Args[2:])
+		return
+	}
 	client := esqrunner.New()
 	flag.StringVar(&configFile, "config", "", "path to configuration file")
 	flag.StringVar(&logLevel, "log-level", "info", "logging severity level")
 	flag.BoolVar(&isValidate, "validate", false, "validate configuration")
 	flag.BoolVar(&isShowVersion, "version", false, "version information")
 	flag.StringVar(&datePicker, "datepicker", "", "date pattern, e.g. last 7 days, interval 1 day")
+	flag.StringVar(&comparePicker, "compare", "", "compare with previous, year-ago, or date pattern")
 	flag.BoolVar(&isLandscape, "landscape", false, "landscape output")
 
-	flag.StringVar(&outputFormat, "output-format", "csv", "output format")
+	flag.StringVar(&outputFormat, "output-format", "csv", "output format, e.g. csv, json, prometheus, openmetrics, influx, graphite, ndjson, xlsx, html, markdown, table")
 	flag.StringVar(&outputDir, "output-dir", "", "output directory")
 	flag.StringVar(&outputFilePrefix, "output-file-prefix", "", "output file prefix")
+	flag.StringVar(&outputTemplate, "output-template", "", "path to text/template file rendering the output")
+	flag.IntVar(&tableWidth, "width", 0, "table output width, defaults to terminal width")
+	flag.BoolVar(&isNoColor, "no-color", false, "disable colors in table output")
+	flag.StringVar(&sortBy, "sort-by", "", "sort metrics in tabular outputs by category, name, or metadata.<key>")
+	flag.BoolVar(&isSubtotals, "subtotals", false, "add category subtotals to tabular outputs")
+	flag.StringVar(&pivotRows, "pivot-rows", "", "pivot tabular outputs with rows by category, name, or metadata.<key>")
+	flag.StringVar(&pivotColumns, "pivot-columns", "", "pivot columns by category, name, or metadata.<key>, defaults to name")
+	flag.StringVar(&pivotDate, "pivot-date", "", "pivot date, e.g. 2020-03-01, defaults to the last period")
+	flag.BoolVar(&isTimestamps, "timestamps", false, "write every period with its timestamp in prometheus and openmetrics outputs")
+
+	flag.StringVar(&recordDir, "record", "", "record Elasticsearch requests and responses to directory")
+	flag.StringVar(&replayDir, "replay", "", "replay Elasticsearch responses from directory")
+
+	flag.BoolVar(&isNoCache, "no-cache", false, "do not use result cache")
+	flag.BoolVar(&isRefreshCache, "refresh-cache", false, "query settled periods and refresh result cache")
+	flag.BoolVar(&isFromHistory, "from-history", false, "render output from history without querying Elasticsearch")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "\n%s - %s\n\n", app.Name, app.Description)
-		fmt.Fprintf(os.Stderr, "Usage: %s [arguments]\n\n", app.Name)
+		fmt.Fprintf(os.Stderr, "Usage: %s [arguments]\n", app.Name)
+		fmt.Fprintf(os.Stderr, "       %s backfill [arguments]\n\n", app.Name)
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nDocumentation: %s\n\n", app.Documentation)
 	}
@@ -97,35 +129,161 @@ func main() {
 		log.Fatalf("invalid dates: %s", err)
 	}
 
+	if comparePicker != "" {
+		if err := client.Config.AddComparison(comparePicker); err != nil {
+			log.Fatalf("invalid comparison: %s", err)
+		}
+	}
+
+	if recordDir != "" || replayDir != "" {
+		if client.Config.Elasticsearch == nil {
+			log.Fatalf("no Elasticsearch configuration found")
+		}
+		client.Config.Elasticsearch.RecordDir = recordDir
+		client.Config.Elasticsearch.ReplayDir = replayDir
+	}
+
+	if client.Config.Cache != nil {
+		client.Config.Cache.Disabled = isNoCache
+		client.Config.Cache.Refresh = isRefreshCache
+	}
+
+	if isFromHistory {
+		if client.Config.History == nil {
+			log.Fatalf("no history configuration found")
+		}
+		client.Config.History.ReadOnly = true
+	}
+
+	if err := client.ValidateConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %s\n", err)
+		os.Exit(1)
+	}
+	if client.Config.HasRenderedOutputs() {
+		// The outputs of the configuration replace the output selected by
+		// the arguments, which would be silently ignored otherwise.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "output-format", "landscape", "output-template":
+				fmt.Fprintf(os.Stderr, "the --%s argument conflicts with the outputs in the configuration\n", f.Name)
+				os.Exit(1)
+			}
+		})
+	}
+
+	isStreaming := outputFormat == "ndjson" && outputDir == "" && outputFilePrefix == ""
+	if isStreaming {
+		client.Stream = esqrunner.NewNDJSONWriter(os.Stdout)
+	}
+
 	if err := client.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
 
-	if outputDir != "" || outputFilePrefix != "" {
+	isWritingFiles := outputDir != "" || outputFilePrefix != ""
+	if isWritingFiles {
 		outputPrefix, err := client.GetOutputFilePrefix(outputDir, outputFilePrefix)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
 			os.Exit(1)
 		}
 		fmt.Fprintf(os.Stderr, "Output file prefix: %s\n", outputPrefix)
-		outputFiles, err := client.WriteToFiles(outputPrefix)
+		client.OutputPrefix = outputPrefix
+	}
+
+	if err := client.Export(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	if isWritingFiles && !client.Config.HasRenderedOutputs() {
+		if _, err := client.WriteToFiles(client.OutputPrefix); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if client.Manifest != nil {
+		for _, entry := range client.Manifest.Outputs {
+			if entry.Destination == "file" {
+				fmt.Fprintf(os.Stderr, "Wrote data to %s\n", entry.Path)
+			}
+		}
+		manifestPath := client.Config.Output.Manifest
+		if manifestPath == "" && isWritingFiles {
+			manifestPath = "{{.Prefix}}_manifest.json"
+		}
+		fp, err := client.WriteManifest(manifestPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
 			os.Exit(1)
 		}
-		for _, f := range outputFiles {
-			fmt.Fprintf(os.Stderr, "Wrote data to %s\n", f)
+		if fp != "" {
+			fmt.Fprintf(os.Stderr, "Wrote manifest to %s\n", fp)
 		}
-		os.Exit(0)
 	}
+
+	if isWritingFiles || client.Config.HasRenderedOutputs() {
+		exitWithEvaluation(client)
+	}
+	if isStreaming {
+		exitWithEvaluation(client)
+	}
+
 	client.Config.Output.Landscape = isLandscape
 	client.Config.Output.Format = outputFormat
+	if outputTemplate != "" {
+		client.Config.Output.Format = "template"
+		client.Config.Output.Template = outputTemplate
+	}
+	if sortBy != "" || isSubtotals || pivotRows != "" {
+		grouping := &esqrunner.GroupingConfig{SortBy: sortBy, Subtotals: isSubtotals}
+		if pivotRows != "" {
+			grouping.Pivot = &esqrunner.PivotConfig{Rows: pivotRows, Columns: pivotColumns, Date: pivotDate}
+		}
+		if err := grouping.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid grouping: %s\n", err)
+			os.Exit(1)
+		}
+		client.Config.Output.Grouping = grouping
+	}
+	if isTimestamps {
+		client.Config.Output.Timestamps = true
+	}
+	client.Config.Output.Width = tableWidth
+	if tableWidth == 0 {
+		client.Config.Output.Width, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+	}
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		client.Config.Output.Color = !isNoColor && os.Getenv("NO_COLOR") == ""
+	}
 	out, err := client.Output()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
+	if outputFormat == "xlsx" {
+		os.Stdout.WriteString(out)
+		exitWithEvaluation(client)
+	}
 	fmt.Fprintf(os.Stdout, "%s\n", out)
-	os.Exit(0)
+	exitWithEvaluation(client)
+}
+
+// exitWithEvaluation reports the fired threshold rules of the metrics, and
+// exits with the exit code of their evaluation.
+func exitWithEvaluation(client *esqrunner.QueryRunner) {
+	evaluation := client.Report().Evaluation
+	if evaluation != nil {
+		for _, res := range evaluation.Fired() {
+			value := "-"
+			if res.Value != nil {
+				value = strconv.FormatFloat(*res.Value, 'f', -1, 64)
+			}
+			fmt.Fprintf(os.Stderr, "%s: %s / %s: %s, value: %s\n",
+				strings.ToUpper(res.Level), res.Category, res.Name, res.Rule, value)
+		}
+	}
+	os.Exit(evaluation.ExitCode())
 }
@@ -0,0 +1,173 @@
+package esqrunner
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ReportComparison describes the periods the results are compared with.
+type ReportComparison struct {
+	Mode    string          `json:"mode"`
+	Periods []*ReportPeriod `json:"periods"`
+}
+
+// PointComparison is the value of a metric for the period the point is
+// compared with, and the change from it.
+type PointComparison struct {
+	Period   *ReportPeriod `json:"period"`
+	Value    *float64      `json:"value"`
+	Filled   bool          `json:"filled,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Delta    *float64      `json:"delta"`
+	DeltaPct *float64      `json:"delta_pct"`
+}
+
+// SummaryComparison holds the summary statistics of the periods the results
+// are compared with, and the changes from them, by statistic name.
+type SummaryComparison struct {
+	Summary *MetricSummary             `json:"summary"`
+	Deltas  map[string]*StatisticDelta `json:"deltas"`
+}
+
+// StatisticDelta is the change of a summary statistic.
+type StatisticDelta struct {
+	Delta    *float64 `json:"delta"`
+	DeltaPct *float64 `json:"delta_pct"`
+}
+
+// AddComparison sets the periods the results are compared with. The mode is
+// either "previous", i.e. the same number of days right before the periods,
+// "year-ago", i.e. the same days a year before, with February 29 compared
+// with February 28, or a date pattern, as in AddDates, resulting in the same
+// number of periods.
+func (c *RunnerConfig) AddComparison(s string) error {
+	if len(c.Timestamps) == 0 {
+		return fmt.Errorf("comparison requires dates")
+	}
+	timestamps := []time.Time{}
+	switch s {
+	case "previous":
+		first, last := c.Timestamps[0], c.Timestamps[len(c.Timestamps)-1]
+		step := 1
+		if len(c.Timestamps) > 1 {
+			step = int(math.Round(c.Timestamps[1].Sub(first).Hours() / 24))
+		}
+		days := int(math.Round(last.Sub(first).Hours()/24)) + step
+		for _, ts := range c.Timestamps {
+			timestamps = append(timestamps, ts.AddDate(0, 0, -days))
+		}
+	case "year-ago":
+		for _, ts := range c.Timestamps {
+			timestamps = append(timestamps, yearAgo(ts))
+		}
+	default:
+		tmp := &RunnerConfig{}
+		if err := tmp.AddDates(s); err != nil {
+			return fmt.Errorf("comparison dates are invalid: %s", err)
+		}
+		if len(tmp.Timestamps) != len(c.Timestamps) {
+			return fmt.Errorf(
+				"comparison has %d periods, expected %d periods aligned with the dates",
+				len(tmp.Timestamps), len(c.Timestamps),
+			)
+		}
+		timestamps = tmp.Timestamps
+	}
+	c.Compare = s
+	c.CompareTimestamps = timestamps
+	return nil
+}
+
+// yearAgo returns the same day a year before. February 29 becomes February
+// 28, rather than March 1, which is compared with March 1.
+func yearAgo(ts time.Time) time.Time {
+	if ts.Month() == time.February && ts.Day() == 29 {
+		return ts.AddDate(-1, 0, -1)
+	}
+	return ts.AddDate(-1, 0, 0)
+}
+
+// collectComparison gets the values of the metrics for the periods the
+// results are compared with. The values are served from the cache and the
+// history, as the values of the periods are. The comparison is not
+// streamed.
+func (r *QueryRunner) collectComparison() {
+	metrics, errs, stream := r.Metrics, r.MetricErrors, r.Stream
+	r.Metrics, r.MetricErrors, r.Stream = nil, nil, nil
+	r.collect(r.Config.CompareTimestamps)
+	r.CompareMetrics, r.CompareErrors = r.Metrics, r.MetricErrors
+	r.Metrics, r.MetricErrors, r.Stream = metrics, errs, stream
+}
+
+// comparePoints returns the data points of a metric for the periods the
+// results are compared with.
+func (r *QueryRunner) comparePoints(m *Metric, output []*TransformConfig) []*MetricPoint {
+	points := r.fillPoints(m, r.Config.CompareTimestamps, r.CompareMetrics, r.CompareErrors)
+	return applyTransforms(points, r.transformsOf(m, output))
+}
+
+// hasComparison returns true when the results are compared with other
+// periods.
+func (r *QueryRunner) hasComparison() bool {
+	return len(r.Config.CompareTimestamps) > 0 && r.CompareMetrics != nil
+}
+
+// delta returns the absolute and percent change from the previous value.
+// The percent change from zero is undefined.
+func delta(prev, cur *float64) (*float64, *float64) {
+	if prev == nil || cur == nil {
+		return nil, nil
+	}
+	d := *cur - *prev
+	if *prev == 0 {
+		return &d, nil
+	}
+	pct := d * 100 / *prev
+	return &d, &pct
+}
+
+// compareResult adds the comparison to the points and the summary of
+// the metric.
+func (r *QueryRunner) compareResult(result *MetricResult, output []*TransformConfig) {
+	points := r.comparePoints(result.metric, output)
+	for i, p := range result.Points {
+		if i >= len(points) {
+			break
+		}
+		c := &PointComparison{
+			Period: points[i].Period,
+			Value:  points[i].Value,
+			Filled: points[i].Filled,
+			Error:  points[i].Error,
+		}
+		c.Delta, c.DeltaPct = delta(c.Value, p.Value)
+		p.Compare = c
+	}
+	summary := summarize(points)
+	result.Compare = &SummaryComparison{
+		Summary: summary,
+		Deltas:  make(map[string]*StatisticDelta),
+	}
+	for _, st := range summaryStatistics {
+		prev, cur := statisticNumber(st, summary), statisticNumber(st, result.Summary)
+		if prev == nil && cur == nil {
+			continue
+		}
+		d := &StatisticDelta{}
+		d.Delta, d.DeltaPct = delta(prev, cur)
+		result.Compare.Deltas[st.name] = d
+	}
+}
+
+// statisticNumber returns the value of a numeric statistic, or nil.
+func statisticNumber(st *summaryStatistic, s *MetricSummary) *float64 {
+	switch v := st.value(s).(type) {
+	case float64:
+		return &v
+	case int:
+		f := float64(v)
+		return &f
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package esqrunner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddComparison(t *testing.T) {
+	r := newTestRunner(t, "http://localhost:9200")
+	testcases := []struct {
+		mode  string
+		first string
+		err   bool
+	}{
+		{mode: "previous", first: "2020-02-27"},
+		{mode: "year-ago", first: "2019-03-01"},
+		{mode: "from 2020-02-01 to 2020-02-03", first: "2020-02-01"},
+		{mode: "from 2020-02-01 to 2020-02-04", err: true},
+		{mode: "last week", err: true},
+	}
+	for _, tc := range testcases {
+		r.Config.CompareTimestamps = nil
+		err := r.Config.AddComparison(tc.mode)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("%s: expected error", tc.mode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", tc.mode, err)
+		}
+		if len(r.Config.CompareTimestamps) != 3 || r.Config.CompareTimestamps[0].Format("2006-01-02") != tc.first {
+			t.Fatalf("%s: unexpected timestamps: %v", tc.mode, r.Config.CompareTimestamps)
+		}
+	}
+
+	leap := &RunnerConfig{}
+	if err := leap.AddDates("from 2020-02-27 to 2020-03-01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := leap.AddComparison("year-ago"); err != nil {
+		t.Fatal(err)
+	}
+	dates := []string{}
+	for _, ts := range leap.CompareTimestamps {
+		dates = append(dates, ts.Format("2006-01-02"))
+	}
+	if strings.Join(dates, ",") != "2019-02-27,2019-02-28,2019-02-28,2019-03-01" {
+		t.Fatalf("unexpected leap year comparison: %v", dates)
+	}
+}
+
+func TestComparison(t *testing.T) {
+	srv := newTestElasticsearch(t, map[string]uint64{
+		"tickets-20200301": 10,
+		"tickets-20200302": 20,
+		"tickets-20200303": 30,
+		"tickets-20200226": 5,
+		"tickets-20200227": 25,
+		"tickets-20200228": 30,
+	})
+	defer srv.Close()
+	r := newTestRunner(t, srv.URL)
+	r.Config.Cache = &CacheConfig{Dir: t.TempDir()}
+	if err := r.Config.AddComparison("from 2020-02-26 to 2020-02-28"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Config.Output.Format = "json"
+	out, err := r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal([]byte(out), report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Comparison == nil || len(report.Comparison.Periods) != 3 {
+		t.Fatalf("report has no comparison:\n%s", out)
+	}
+	m := report.Metrics[0]
+	p := m.Points[0].Compare
+	if *p.Value != 5 || *p.Delta != 5 || *p.DeltaPct != 100 || !p.Period.Start.Equal(time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected point comparison: %+v", p)
+	}
+	total := m.Compare.Deltas["total"]
+	if m.Compare.Summary.Total != 60 || *total.Delta != 0 || *total.DeltaPct != 0 {
+		t.Fatalf("unexpected summary comparison: %+v", m.Compare)
+	}
+
+	r.Config.Output.Format = "csv"
+	r.Config.Output.Statistics = []string{"total"}
+	for _, landscape := range []bool{true, false} {
+		r.Config.Output.Landscape = landscape
+		out, err = r.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr := csv.NewReader(strings.NewReader(out))
+		cr.Comma = ';'
+		records, err := cr.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var header, row string
+		if landscape {
+			header, row = strings.Join(records[0][5:], ","), strings.Join(records[1][5:9], ",")
+			if header != "Compare 2020/02/26,Compare 2020/02/27,Compare 2020/02/28,Total,Total Compare,Total Delta,Total Delta %,Metric ID" || row != "5,25,30,60.00" {
+				t.Fatalf("unexpected landscape comparison:\n%s", out)
+			}
+			continue
+		}
+		header, row = strings.Join(records[0][:6], ","), strings.Join(records[2][:6], ",")
+		if header != "Date,Value,Compare Date,Compare Value,Delta,Delta %" || row != "2020/03/02,20,2020/02/27,25,-5,-20.00" {
+			t.Fatalf("unexpected portrait comparison:\n%s", out)
+		}
+	}
+}
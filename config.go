@@ -9,18 +9,49 @@ import (
 	"time"
 )
 
+var supportedOutputFormats = map[string]bool{
+	"csv":         true,
+	"json":        true,
+	"js":          true,
+	"prometheus":  true,
+	"openmetrics": true,
+	"influx":      true,
+	"graphite":    true,
+	"ndjson":      true,
+	"xlsx":        true,
+	"html":        true,
+	"markdown":    true,
+	"table":       true,
+	"template":    true,
+}
+
 // RunnerConfig is the configuration of the QueryRunner.
 type RunnerConfig struct {
-	MetricRef  map[string]*Metric `json:"-" yaml:"-"`
-	Metrics    []*Metric          `json:"-" yaml:"-"`
-	Timestamps []time.Time        `json:"-" yaml:"-"`
-	Output     struct {
-		Landscape bool   `json:"-" yaml:"-"`
-		Format    string `json:"-" yaml:"-"`
-		Offset    string `json:"-" yaml:"-"`
-	}
+	MetricRef         map[string]*Metric `json:"-" yaml:"-"`
+	Metrics           []*Metric          `json:"-" yaml:"-"`
+	Timestamps        []time.Time        `json:"-" yaml:"-"`
+	Compare           string             `json:"-" yaml:"-"`
+	CompareTimestamps []time.Time        `json:"-" yaml:"-"`
+	Output            struct {
+		Landscape  bool            `json:"-" yaml:"-"`
+		Format     string          `json:"-" yaml:"-"`
+		Offset     string          `json:"-" yaml:"-"`
+		Width      int             `json:"-" yaml:"-"`
+		Color      bool            `json:"-" yaml:"-"`
+		Template   string          `json:"-" yaml:"-"`
+		CSV        CSVConfig       `json:"csv" yaml:"csv"`
+		Manifest   string          `json:"manifest" yaml:"manifest"`
+		Statistics []string        `json:"statistics" yaml:"statistics"`
+		Grouping   *GroupingConfig `json:"grouping" yaml:"grouping"`
+		Timestamps bool            `json:"timestamps" yaml:"timestamps"`
+	} `json:"output" yaml:"output"`
 	MetricSources []string             `json:"metric_sources" yaml:"metric_sources"`
 	Elasticsearch *ElasticsearchConfig `json:"elasticsearch" yaml:"elasticsearch"`
+	Cache         *CacheConfig         `json:"cache" yaml:"cache"`
+	History       *HistoryConfig       `json:"history" yaml:"history"`
+	Outputs       []*OutputConfig      `json:"outputs" yaml:"outputs"`
+	MissingData   string               `json:"missing_data" yaml:"missing_data"`
+	Transforms    []*TransformConfig   `json:"transforms" yaml:"transforms"`
 	Metadata      struct {
 		FieldList []string       `json:"-" yaml:"-"`
 		Fields    map[string]int `json:"-" yaml:"-"`
@@ -40,20 +71,59 @@ func (c *RunnerConfig) Validate() error {
 		return err
 	}
 
-	supportedFormats := map[string]bool{
-		"csv":  true,
-		"json": true,
+	if c.Cache != nil {
+		if err := c.Cache.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.History != nil {
+		if err := c.History.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for i, o := range c.Outputs {
+		if err := o.Validate(c); err != nil {
+			return fmt.Errorf("output %d is invalid: %s", i, err)
+		}
 	}
+
+	if c.MissingData == "" {
+		c.MissingData = "skip"
+	}
+	if _, supported := supportedMissingData[c.MissingData]; !supported {
+		return fmt.Errorf("missing data policy is unsupported: %s", c.MissingData)
+	}
+
+	if err := validateTransforms(c.Transforms, true); err != nil {
+		return err
+	}
+
 	if c.Output.Format == "" {
 		c.Output.Format = "csv"
 	}
 
-	if _, exists := supportedFormats[c.Output.Format]; !exists {
+	if _, exists := supportedOutputFormats[c.Output.Format]; !exists {
 		return fmt.Errorf("the following output format is not supported: %s", c.Output.Format)
 	}
 
 	log.Debugf("output format: %s", c.Output.Format)
 
+	if err := c.Output.CSV.Validate(); err != nil {
+		return err
+	}
+
+	if err := validateStatistics(c.Output.Statistics); err != nil {
+		return err
+	}
+
+	if c.Output.Grouping != nil {
+		if err := c.Output.Grouping.Validate(); err != nil {
+			return err
+		}
+	}
+
 	if len(c.MetricSources) == 0 {
 		return fmt.Errorf("no metric configuration files found")
 	}
@@ -104,6 +174,40 @@ func (c *RunnerConfig) Validate() error {
 		}
 	}
 
+	for _, m := range c.Metrics {
+		if m.SLO == nil || m.Disabled {
+			continue
+		}
+		if err := m.SLO.resolve(m, c.MetricRef); err != nil {
+			return fmt.Errorf("metric %s is invalid: %s", m.ID, err)
+		}
+		if err := validateSLOTransforms(m.Transforms); err != nil {
+			return fmt.Errorf("metric %s is invalid: %s", m.ID, err)
+		}
+		if err := validateSLOTransforms(c.Transforms); err != nil {
+			return fmt.Errorf("metric %s is invalid with the transforms of the configuration: %s", m.ID, err)
+		}
+		for i, o := range c.Outputs {
+			if err := validateSLOTransforms(o.Transforms); err != nil {
+				return fmt.Errorf("metric %s is invalid with the transforms of output %d: %s", m.ID, i, err)
+			}
+		}
+	}
+
+	for _, m := range c.Metrics {
+		if m.Anomaly == nil || m.Anomaly.Method != "seasonal" || m.Disabled {
+			continue
+		}
+		if err := validateAnomalyTransforms(c.Transforms); err != nil {
+			return fmt.Errorf("metric %s is invalid with the transforms of the configuration: %s", m.ID, err)
+		}
+		for i, o := range c.Outputs {
+			if err := validateAnomalyTransforms(o.Transforms); err != nil {
+				return fmt.Errorf("metric %s is invalid with the transforms of output %d: %s", m.ID, i, err)
+			}
+		}
+	}
+
 	if c.Metadata.Size > 0 {
 		for k, v := range c.Metadata.Fields {
 			c.Metadata.FieldList = append(c.Metadata.FieldList, k)
@@ -139,5 +243,35 @@ func (c *RunnerConfig) AddDates(s string) error {
 		return nil
 	}
 
+	dateRangeRegex, err := regexp.Compile(`^from (\d{4}-\d{2}-\d{2}) to (\d{4}-\d{2}-\d{2})$`)
+	if err != nil {
+		return err
+	}
+	if m := dateRangeRegex.FindStringSubmatch(s); len(m) > 0 {
+		from, err := time.ParseInLocation("2006-01-02", m[1], time.Local)
+		if err != nil {
+			return err
+		}
+		to, err := time.ParseInLocation("2006-01-02", m[2], time.Local)
+		if err != nil {
+			return err
+		}
+		if to.Before(from) {
+			return fmt.Errorf("dates pattern ends before it starts: %s", s)
+		}
+		c.Timestamps = append(c.Timestamps, dailyTimestamps(from, to)...)
+		return nil
+	}
+
 	return fmt.Errorf("unsupported dates pattern: %s", s)
 }
+
+// dailyTimestamps returns the start of each day between two dates,
+// inclusive.
+func dailyTimestamps(from, to time.Time) []time.Time {
+	timestamps := []time.Time{}
+	for t := from; !t.After(to); t = t.AddDate(0, 0, 1) {
+		timestamps = append(timestamps, t)
+	}
+	return timestamps
+}
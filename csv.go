@@ -0,0 +1,382 @@
+package esqrunner
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVConfig is the configuration of CSV output.
+type CSVConfig struct {
+	Delimiter    string `json:"delimiter" yaml:"delimiter"`
+	Quoting      string `json:"quoting" yaml:"quoting"`
+	LineEnding   string `json:"line_ending" yaml:"line_ending"`
+	BOM          bool   `json:"bom" yaml:"bom"`
+	DateFormat   string `json:"date_format" yaml:"date_format"`
+	NumberFormat string `json:"number_format" yaml:"number_format"`
+}
+
+// Validate validates CSVConfig.
+func (c *CSVConfig) Validate() error {
+	if c.Delimiter == "" {
+		c.Delimiter = ";"
+	}
+	if utf8.RuneCountInString(c.Delimiter) != 1 {
+		return fmt.Errorf("csv delimiter must be a single character: %q", c.Delimiter)
+	}
+	if d, _ := utf8.DecodeRuneInString(c.Delimiter); d == '"' || d == '\r' || d == '\n' {
+		return fmt.Errorf("csv delimiter is invalid: %q", c.Delimiter)
+	}
+	switch c.Quoting {
+	case "":
+		c.Quoting = "minimal"
+	case "minimal", "all":
+	default:
+		return fmt.Errorf("csv quoting is unsupported: %s", c.Quoting)
+	}
+	switch c.LineEnding {
+	case "":
+		c.LineEnding = "lf"
+	case "lf", "crlf":
+	default:
+		return fmt.Errorf("csv line ending is unsupported: %s", c.LineEnding)
+	}
+	if c.DateFormat == "" {
+		c.DateFormat = "2006/01/02"
+	}
+	if c.NumberFormat == "" {
+		c.NumberFormat = "%.2f"
+	}
+	if s := fmt.Sprintf(c.NumberFormat, 1.0); strings.Contains(s, "%!") {
+		return fmt.Errorf("csv number format is invalid: %s", c.NumberFormat)
+	}
+	return nil
+}
+
+// csvLandscapeRows returns the rows of the landscape layout: a row per
+// metric, a column per period, and a column per summary statistic. When the
+// results are compared with other periods, the layout has a column per
+// compared period, and the columns of the compared summary statistics
+// and their changes. With anomaly detection, the layout has a column of the
+// flagged periods. With forecasts, the layout has a column per projected
+// period, and the columns of the slope and the trend. When metrics have
+// units, the layout has a column of the units. The rows are the results in
+// the order of the grouping, including the subtotals.
+func (r *QueryRunner) csvLandscapeRows(report *Report, results []*MetricResult, stats []*summaryStatistic) [][]string {
+	cfg := r.Config.Output.CSV
+	rows := [][]string{}
+	line := []string{}
+	line = append(line, "Categories")
+	line = append(line, "Metrics")
+	for _, k := range r.Config.Metadata.FieldList {
+		line = append(line, strings.Title(k))
+	}
+	periods := report.Periods
+	for _, p := range periods {
+		line = append(line, p.Start.Format(cfg.DateFormat))
+	}
+	if r.hasComparison() {
+		for _, p := range report.Comparison.Periods {
+			line = append(line, "Compare "+p.Start.Format(cfg.DateFormat))
+		}
+	}
+	forecastPeriods := r.forecastPeriods(periods)
+	for _, p := range forecastPeriods {
+		line = append(line, "Forecast "+p.Start.Format(cfg.DateFormat))
+	}
+	if r.hasForecast() {
+		line = append(line, "Forecast Slope", "Forecast Trend")
+	}
+	for _, st := range stats {
+		line = append(line, st.title)
+		if r.hasComparison() {
+			line = append(line, st.title+" Compare", st.title+" Delta", st.title+" Delta %")
+		}
+	}
+	if r.hasAnomalyDetection() {
+		line = append(line, "Anomalies")
+	}
+	if r.hasUnits() {
+		line = append(line, "Unit")
+	}
+	line = append(line, "Metric ID")
+	rows = append(rows, line)
+
+	for _, result := range results {
+		m := result.Metric()
+		line = []string{}
+		line = append(line, m.Category)
+		line = append(line, m.Name)
+
+		for _, k := range r.Config.Metadata.FieldList {
+			if v, exists := m.Metadata[k]; exists {
+				line = append(line, v)
+			} else {
+				line = append(line, "-")
+			}
+		}
+
+		for _, p := range result.Points {
+			if p.Value != nil {
+				line = append(line, m.formatNumber(*p.Value, ""))
+			} else {
+				line = append(line, r.missingValue(m))
+			}
+		}
+		if r.hasComparison() {
+			for _, p := range result.Points {
+				if p.Compare != nil {
+					line = append(line, r.csvNumber(m, p.Compare.Value, ""))
+				} else {
+					line = append(line, "-")
+				}
+			}
+		}
+		if r.hasForecast() {
+			f := result.Forecast
+			for i := range forecastPeriods {
+				if f != nil && i < len(f.Points) {
+					line = append(line, m.formatNumber(f.Points[i].Value, cfg.NumberFormat))
+				} else {
+					line = append(line, "-")
+				}
+			}
+			if f != nil {
+				line = append(line, m.formatNumber(f.Slope, cfg.NumberFormat), f.Trend)
+			} else {
+				line = append(line, "-", "-")
+			}
+		}
+		for _, st := range stats {
+			line = append(line, m.statisticText(st, result.Summary, cfg.NumberFormat, false))
+			switch {
+			case result.Compare != nil:
+				line = append(line, m.statisticText(st, result.Compare.Summary, cfg.NumberFormat, false))
+				if d, exists := result.Compare.Deltas[st.name]; exists {
+					line = append(line, r.csvNumber(m, d.Delta, cfg.NumberFormat), r.csvPercent(m, d.DeltaPct))
+				} else {
+					line = append(line, "-", "-")
+				}
+			case r.hasComparison():
+				line = append(line, "-", "-", "-")
+			}
+		}
+		if r.hasAnomalyDetection() {
+			anomalies := []string{}
+			for _, p := range result.Points {
+				if p.Anomaly != nil {
+					anomalies = append(anomalies, p.Period.Start.Format(cfg.DateFormat)+": "+anomalyText(p.Anomaly))
+				}
+			}
+			line = append(line, strings.Join(anomalies, "; "))
+		}
+		if r.hasUnits() {
+			line = append(line, m.unitName())
+		}
+		line = append(line, m.ID)
+		rows = append(rows, line)
+	}
+	return rows
+}
+
+// csvPortraitRows returns the rows of the portrait layout: a row per
+// metric and period. When the results are compared with other periods,
+// the rows have the compared period, its value, and the change from it.
+// With anomaly detection, the rows have the anomaly flag, the baseline and
+// the score. With forecasts, the rows of the projected periods follow the
+// rows of each metric, and the rows have the type, either observed or
+// forecast, and the bounds of the confidence band. When metrics have units,
+// the rows have the unit of the metric. The metrics are the results in the
+// order of the grouping, including the subtotals.
+func (r *QueryRunner) csvPortraitRows(results []*MetricResult) [][]string {
+	cfg := r.Config.Output.CSV
+	rows := [][]string{}
+	line := []string{}
+	line = append(line, "Date")
+	line = append(line, "Value")
+	if r.hasComparison() {
+		line = append(line, "Compare Date", "Compare Value", "Delta", "Delta %")
+	}
+	if r.hasAnomalyDetection() {
+		line = append(line, "Anomaly", "Anomaly Baseline", "Anomaly Score")
+	}
+	if r.hasForecast() {
+		line = append(line, "Type", "Lower", "Upper")
+	}
+	line = append(line, "Category")
+	line = append(line, "Metric Name")
+	for _, k := range r.Config.Metadata.FieldList {
+		line = append(line, strings.Title(k))
+	}
+	if r.hasUnits() {
+		line = append(line, "Unit")
+	}
+	line = append(line, "Metric ID")
+	rows = append(rows, line)
+
+	for _, result := range results {
+		m := result.Metric()
+		metricColumns := []string{m.Category, m.Name}
+		for _, k := range r.Config.Metadata.FieldList {
+			if v, exists := m.Metadata[k]; exists {
+				metricColumns = append(metricColumns, v)
+			} else {
+				metricColumns = append(metricColumns, "-")
+			}
+		}
+		if r.hasUnits() {
+			metricColumns = append(metricColumns, m.unitName())
+		}
+		metricColumns = append(metricColumns, m.ID)
+		for _, p := range result.Points {
+			line := []string{}
+			line = append(line, p.Period.Start.Format(cfg.DateFormat))
+
+			if p.Value != nil {
+				line = append(line, m.formatNumber(*p.Value, ""))
+			} else {
+				line = append(line, r.missingValue(m))
+			}
+			if c := p.Compare; c != nil {
+				line = append(line, c.Period.Start.Format(cfg.DateFormat))
+				line = append(line, r.csvNumber(m, c.Value, ""))
+				line = append(line, r.csvNumber(m, c.Delta, ""), r.csvPercent(m, c.DeltaPct))
+			} else if r.hasComparison() {
+				line = append(line, "", "", "", "")
+			}
+			if r.hasAnomalyDetection() {
+				if a := p.Anomaly; a != nil {
+					line = append(line, "yes", m.formatNumber(a.Baseline, cfg.NumberFormat), fmt.Sprintf(cfg.NumberFormat, a.Score))
+				} else {
+					line = append(line, "", "", "")
+				}
+			}
+			if r.hasForecast() {
+				line = append(line, "observed", "", "")
+			}
+			line = append(line, metricColumns...)
+			rows = append(rows, line)
+		}
+		f := result.Forecast
+		if f == nil {
+			continue
+		}
+		for _, p := range f.Points {
+			line := []string{}
+			line = append(line, p.Period.Start.Format(cfg.DateFormat))
+			line = append(line, m.formatNumber(p.Value, cfg.NumberFormat))
+			if r.hasComparison() {
+				line = append(line, "", "", "", "")
+			}
+			if r.hasAnomalyDetection() {
+				line = append(line, "", "", "")
+			}
+			line = append(line, "forecast", m.formatNumber(p.Lower, cfg.NumberFormat), m.formatNumber(p.Upper, cfg.NumberFormat))
+			line = append(line, metricColumns...)
+			rows = append(rows, line)
+		}
+	}
+	return rows
+}
+
+// csvPivotRows returns the rows of a pivot table: a header with the title
+// of the rows and the columns, and a row per row of the table. The values
+// have the precision of the metrics of the cells, without the units.
+func csvPivotRows(table *pivotTable) [][]string {
+	rows := [][]string{append([]string{table.Title}, table.Columns...)}
+	for _, row := range table.Rows {
+		line := []string{row.Name}
+		for i, v := range row.Values {
+			if v == nil {
+				line = append(line, "-")
+				continue
+			}
+			line = append(line, row.Metrics[i].formatNumber(*v, ""))
+		}
+		rows = append(rows, line)
+	}
+	return rows
+}
+
+// csvNumber returns the text of an optional number with the precision of
+// the metric. When the metric has no precision and the number format is
+// empty, the shortest representation is used.
+func (r *QueryRunner) csvNumber(m *Metric, v *float64, numberFormat string) string {
+	if v == nil {
+		return r.missingValue(m)
+	}
+	return m.formatNumber(*v, numberFormat)
+}
+
+// csvPercent returns the text of an optional percent change in the number
+// format.
+func (r *QueryRunner) csvPercent(m *Metric, v *float64) string {
+	if v == nil {
+		return r.missingValue(m)
+	}
+	return fmt.Sprintf(r.Config.Output.CSV.NumberFormat, *v)
+}
+
+// outputCSV writes metric data in CSV format, as described in RFC 4180.
+//
+// References:
+//
+// - [RFC 4180](https://www.rfc-editor.org/rfc/rfc4180)
+func (r *QueryRunner) outputCSV(w io.Writer, opts *renderOptions) error {
+	cfg := r.Config.Output.CSV
+	report := r.report(opts.Transforms)
+	results, pivot, err := opts.groupedRows(report)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	switch {
+	case pivot != nil:
+		rows = csvPivotRows(pivot)
+	case opts.Landscape:
+		rows = r.csvLandscapeRows(report, results, selectStatistics(opts.Statistics, csvStatistics))
+	default:
+		rows = r.csvPortraitRows(results)
+	}
+	if cfg.BOM {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return err
+		}
+	}
+	delimiter, _ := utf8.DecodeRuneInString(cfg.Delimiter)
+	if cfg.Quoting == "all" {
+		return writeQuotedCSV(w, rows, cfg.Delimiter, cfg.LineEnding == "crlf")
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = delimiter
+	cw.UseCRLF = cfg.LineEnding == "crlf"
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeQuotedCSV writes CSV records with every field quoted. The
+// encoding/csv package quotes the fields only when necessary.
+func writeQuotedCSV(w io.Writer, rows [][]string, delimiter string, crlf bool) error {
+	eol := "\n"
+	if crlf {
+		eol = "\r\n"
+	}
+	for _, row := range rows {
+		fields := make([]string, len(row))
+		for i, field := range row {
+			if crlf {
+				field = strings.Replace(field, "\r\n", "\n", -1)
+				field = strings.Replace(field, "\n", "\r\n", -1)
+			}
+			fields[i] = `"` + strings.Replace(field, `"`, `""`, -1) + `"`
+		}
+		if _, err := io.WriteString(w, strings.Join(fields, delimiter)+eol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
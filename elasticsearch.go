@@ -17,7 +17,9 @@ import (
 // ElasticsearchConfig represents conntenction settings associated with Elasticsearch
 // instance.
 type ElasticsearchConfig struct {
-	Address []string `json:"addr" yaml:"addr"`
+	Address   []string `json:"addr" yaml:"addr"`
+	RecordDir string   `json:"-" yaml:"-"`
+	ReplayDir string   `json:"-" yaml:"-"`
 }
 
 // ValidateConfig validates ElasticsearchConfig.
@@ -25,6 +27,9 @@ func (es *ElasticsearchConfig) ValidateConfig() error {
 	if len(es.Address) < 1 {
 		return fmt.Errorf("Elasticsearch config has no address")
 	}
+	if es.RecordDir != "" && es.ReplayDir != "" {
+		return fmt.Errorf("Elasticsearch config has both record and replay directories")
+	}
 	return nil
 }
 
@@ -37,17 +42,35 @@ type ElasticsearchClient struct {
 func NewElasticsearchClient(cfg *ElasticsearchConfig) (*ElasticsearchClient, error) {
 	c := &ElasticsearchClient{}
 
+	var transport http.RoundTripper
+	transport = &http.Transport{
+		MaxIdleConnsPerHost:   10,
+		ResponseHeaderTimeout: time.Duration(5) * time.Second,
+		DialContext:           (&net.Dialer{Timeout: time.Duration(5) * time.Second}).DialContext,
+		TLSClientConfig: &tls.Config{
+			MaxVersion:         tls.VersionTLS13,
+			InsecureSkipVerify: true,
+		},
+	}
+
+	switch {
+	case cfg.ReplayDir != "":
+		player, err := NewCassettePlayer(cfg.ReplayDir)
+		if err != nil {
+			return nil, err
+		}
+		transport = player
+	case cfg.RecordDir != "":
+		recorder, err := NewCassetteRecorder(cfg.RecordDir, transport)
+		if err != nil {
+			return nil, err
+		}
+		transport = recorder
+	}
+
 	esConfig := elasticsearch7.Config{
 		Addresses: cfg.Address,
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost:   10,
-			ResponseHeaderTimeout: time.Duration(5) * time.Second,
-			DialContext:           (&net.Dialer{Timeout: time.Duration(5) * time.Second}).DialContext,
-			TLSClientConfig: &tls.Config{
-				MaxVersion:         tls.VersionTLS13,
-				InsecureSkipVerify: true,
-			},
-		},
+		Transport: transport,
 	}
 
 	client, err := elasticsearch7.NewClient(esConfig)
@@ -61,7 +84,9 @@ func NewElasticsearchClient(cfg *ElasticsearchConfig) (*ElasticsearchClient, err
 
 // ElasticsearchInfo contains server info.
 type ElasticsearchInfo struct {
-	Version string
+	Version     string
+	ClusterName string
+	ClusterUUID string
 }
 
 // Info returns Elasticsearch info.
@@ -80,6 +105,12 @@ func (c *ElasticsearchClient) Info() (*ElasticsearchInfo, error) {
 	}
 	info := &ElasticsearchInfo{}
 	info.Version = r["version"].(map[string]interface{})["number"].(string)
+	if v, ok := r["cluster_name"].(string); ok {
+		info.ClusterName = v
+	}
+	if v, ok := r["cluster_uuid"].(string); ok {
+		info.ClusterUUID = v
+	}
 	return info, nil
 }
 
@@ -140,3 +171,56 @@ func (c *ElasticsearchClient) Count(m *Metric, suffix string) (*ElasticsearchCou
 	counter.Total = uint64(count)
 	return counter, nil
 }
+
+// ElasticsearchBulkResult is the result of a bulk request.
+type ElasticsearchBulkResult struct {
+	Indexed int
+	Failed  int
+	Errors  []string
+}
+
+// Bulk sends newline-delimited actions and documents to the Bulk API.
+// When create is true, the version conflicts are not counted as failures,
+// because the documents with the same IDs already exist.
+//
+// References:
+//
+// - [Elasticsearch Reference - Bulk API](https://www.elastic.co/guide/en/elasticsearch/reference/master/docs-bulk.html)
+func (c *ElasticsearchClient) Bulk(index string, body []byte, create bool) (*ElasticsearchBulkResult, error) {
+	res, err := c.driver.Bulk(
+		bytes.NewReader(body),
+		c.driver.Bulk.WithContext(context.Background()),
+		c.driver.Bulk.WithIndex(index),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("elasticsearch connection error: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch bulk error: %s", res.String())
+	}
+	var r struct {
+		Errors bool                                `json:"errors"`
+		Items  []map[string]map[string]interface{} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("Error parsing elasticsearch response body: %s", err)
+	}
+	result := &ElasticsearchBulkResult{}
+	for _, item := range r.Items {
+		for _, v := range item {
+			status, _ := v["status"].(float64)
+			if status >= 200 && status < 300 {
+				result.Indexed++
+				continue
+			}
+			if create && status == http.StatusConflict {
+				result.Indexed++
+				continue
+			}
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("%v: %v", v["_id"], v["error"]))
+		}
+	}
+	return result, nil
+}
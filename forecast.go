@@ -0,0 +1,316 @@
+package esqrunner
+
+import (
+	"fmt"
+	"math"
+)
+
+// ForecastConfig is the configuration of the forecast of a metric. The
+// methods are:
+//
+// - linear: the least squares line through the values
+// - holt_winters: the additive Holt-Winters exponential smoothing, with the
+// level, the trend and the seasonal components, smoothed by alpha, beta and
+// gamma factors
+//
+// The forecast projects the provided number of periods, 7 by default, with
+// the confidence bands at the confidence level, 0.95 by default. The season
+// of holt_winters method is the number of periods, 7 by default, and the
+// first two seasons of the series must have values.
+type ForecastConfig struct {
+	Method     string  `json:"method" yaml:"method"`
+	Periods    int     `json:"periods,omitempty" yaml:"periods"`
+	Confidence float64 `json:"confidence,omitempty" yaml:"confidence"`
+	Season     int     `json:"season,omitempty" yaml:"season"`
+	Alpha      float64 `json:"alpha,omitempty" yaml:"alpha"`
+	Beta       float64 `json:"beta,omitempty" yaml:"beta"`
+	Gamma      float64 `json:"gamma,omitempty" yaml:"gamma"`
+}
+
+// MetricForecast is the projection of a metric. The slope is the change of
+// the value per period, and the trend is either up, down, or flat, when the
+// change over the series is within the error of the fit.
+type MetricForecast struct {
+	Method     string           `json:"method"`
+	Confidence float64          `json:"confidence"`
+	Slope      float64          `json:"slope"`
+	Trend      string           `json:"trend"`
+	Points     []*ForecastPoint `json:"points"`
+}
+
+// ForecastPoint is the projected value of a metric for a future period,
+// and the lower and upper bounds of its confidence band.
+type ForecastPoint struct {
+	Period *ReportPeriod `json:"period"`
+	Value  float64       `json:"value"`
+	Lower  float64       `json:"lower"`
+	Upper  float64       `json:"upper"`
+}
+
+// Validate validates ForecastConfig.
+func (c *ForecastConfig) Validate() error {
+	switch c.Method {
+	case "linear":
+	case "holt_winters":
+		if c.Season == 0 {
+			c.Season = 7
+		}
+		if c.Season < 2 {
+			return fmt.Errorf("forecast season must be at least 2: %d", c.Season)
+		}
+		if c.Alpha == 0 {
+			c.Alpha = 0.5
+		}
+		if c.Beta == 0 {
+			c.Beta = 0.1
+		}
+		if c.Gamma == 0 {
+			c.Gamma = 0.1
+		}
+		for _, f := range []float64{c.Alpha, c.Beta, c.Gamma} {
+			if f < 0 || f > 1 {
+				return fmt.Errorf("forecast smoothing factor must be between 0 and 1: %v", f)
+			}
+		}
+	default:
+		return fmt.Errorf("forecast method is unsupported: %s", c.Method)
+	}
+	if c.Periods == 0 {
+		c.Periods = 7
+	}
+	if c.Periods < 0 {
+		return fmt.Errorf("forecast periods must be positive: %d", c.Periods)
+	}
+	if c.Confidence == 0 {
+		c.Confidence = 0.95
+	}
+	if c.Confidence <= 0 || c.Confidence >= 1 {
+		return fmt.Errorf("forecast confidence must be between 0 and 1: %v", c.Confidence)
+	}
+	return nil
+}
+
+// forecast returns the projection of the series, or nil when the series is
+// too short for the method: three values for linear method, and two
+// seasons of values for holt_winters method.
+func forecast(points []*MetricPoint, c *ForecastConfig) *MetricForecast {
+	if c == nil || len(points) == 0 {
+		return nil
+	}
+	var f *MetricForecast
+	switch c.Method {
+	case "linear":
+		f = linearForecast(points, c)
+	case "holt_winters":
+		f = holtWintersForecast(points, c)
+	}
+	if f == nil {
+		return nil
+	}
+	f.Method, f.Confidence = c.Method, c.Confidence
+	periods := forecastPeriods(points, c.Periods)
+	for i, p := range f.Points {
+		p.Period = periods[i]
+	}
+	return f
+}
+
+// linearForecast fits the least squares line through the values, with the
+// index of the period as the variable. The confidence bands are the
+// prediction intervals of the fit.
+func linearForecast(points []*MetricPoint, c *ForecastConfig) *MetricForecast {
+	var xs, ys []float64
+	for i, p := range points {
+		if p.Value != nil {
+			xs = append(xs, float64(i))
+			ys = append(ys, *p.Value)
+		}
+	}
+	n := float64(len(xs))
+	if n < 3 {
+		return nil
+	}
+	var xm, ym float64
+	for i := range xs {
+		xm += xs[i]
+		ym += ys[i]
+	}
+	xm, ym = xm/n, ym/n
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - xm) * (xs[i] - xm)
+		sxy += (xs[i] - xm) * (ys[i] - ym)
+	}
+	slope := sxy / sxx
+	intercept := ym - slope*xm
+	var sse float64
+	for i := range xs {
+		e := ys[i] - (intercept + slope*xs[i])
+		sse += e * e
+	}
+	se := math.Sqrt(sse / (n - 2))
+	z := confidenceZ(c.Confidence)
+	f := &MetricForecast{Slope: slope, Trend: forecastTrend(slope, xs[len(xs)-1]-xs[0], se)}
+	for h := 1; h <= c.Periods; h++ {
+		x := float64(len(points) - 1 + h)
+		v := intercept + slope*x
+		band := z * se * math.Sqrt(1+1/n+(x-xm)*(x-xm)/sxx)
+		f.Points = append(f.Points, &ForecastPoint{Value: v, Lower: v - band, Upper: v + band})
+	}
+	return f
+}
+
+// holtWintersForecast smooths the series with additive Holt-Winters method.
+// The periods without values after the first two seasons take the one step
+// forecast. The confidence bands widen with the square root of the horizon
+// from the error of the one step forecasts.
+func holtWintersForecast(points []*MetricPoint, c *ForecastConfig) *MetricForecast {
+	m := c.Season
+	if len(points) < 2*m {
+		return nil
+	}
+	// The filled values take part in the smoothing, which requires the
+	// first two seasons without gaps.
+	values := []float64{}
+	for _, p := range points[:2*m] {
+		if p.Value == nil {
+			return nil
+		}
+		values = append(values, *p.Value)
+	}
+	ys := make([]float64, len(points))
+	known := make([]bool, len(points))
+	for i, p := range points {
+		if p.Value != nil {
+			ys[i], known[i] = *p.Value, true
+		}
+	}
+	// The initial components are estimated from the first two seasons of
+	// the values.
+	var first, second float64
+	for i := 0; i < m; i++ {
+		first += values[i]
+		second += values[m+i]
+	}
+	first, second = first/float64(m), second/float64(m)
+	level, trend := first, (second-first)/float64(m)
+	seasonal := make([]float64, m)
+	for i := 0; i < m; i++ {
+		seasonal[i] = values[i] - first
+	}
+
+	var sse float64
+	errs := 0
+	for i := range ys {
+		s := seasonal[i%m]
+		expected := level + trend + s
+		y := expected
+		if known[i] {
+			y = ys[i]
+			if i > 0 {
+				sse += (y - expected) * (y - expected)
+				errs++
+			}
+		}
+		prev := level
+		level = c.Alpha*(y-s) + (1-c.Alpha)*(level+trend)
+		trend = c.Beta*(level-prev) + (1-c.Beta)*trend
+		seasonal[i%m] = c.Gamma*(y-level) + (1-c.Gamma)*s
+	}
+	var se float64
+	if errs > 0 {
+		se = math.Sqrt(sse / float64(errs))
+	}
+	z := confidenceZ(c.Confidence)
+	f := &MetricForecast{Slope: trend, Trend: forecastTrend(trend, float64(len(ys)-1), se)}
+	for h := 1; h <= c.Periods; h++ {
+		v := level + float64(h)*trend + seasonal[(len(ys)+h-1)%m]
+		band := z * se * math.Sqrt(float64(h))
+		f.Points = append(f.Points, &ForecastPoint{Value: v, Lower: v - band, Upper: v + band})
+	}
+	return f
+}
+
+// confidenceZ returns the two-sided critical value of the standard normal
+// distribution for the confidence level, e.g. 1.96 for 0.95.
+func confidenceZ(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+// forecastTrend returns the direction of the slope. The trend is flat when
+// the change over the span of the series is within the error of the fit.
+func forecastTrend(slope, span, se float64) string {
+	switch {
+	case math.Abs(slope*span) <= se:
+		return "flat"
+	case slope > 0:
+		return "up"
+	}
+	return "down"
+}
+
+// forecastPeriods returns the periods following the series. The periods
+// of the monthly and quarterly rollups step in months, and the other
+// periods step in days, as the last two periods do. The projected periods
+// of the rollups are whole calendar periods.
+func forecastPeriods(points []*MetricPoint, n int) []*ReportPeriod {
+	last := points[len(points)-1].Period
+	months := 0
+	for _, k := range []int{1, 3} {
+		if last.Start.Day() == 1 && last.End.Equal(last.Start.AddDate(0, k, 0)) {
+			months = k
+		}
+	}
+	days := int(math.Round(last.End.Sub(last.Start).Hours() / 24))
+	if len(points) > 1 {
+		days = int(math.Round(last.Start.Sub(points[len(points)-2].Period.Start).Hours() / 24))
+	}
+	switch last.rollup {
+	case "week":
+		months, days = 0, 7
+	case "month":
+		months = 1
+	case "quarter":
+		months = 3
+	}
+	periods := []*ReportPeriod{}
+	for h := 1; h <= n; h++ {
+		if months > 0 {
+			start := last.Start.AddDate(0, months*h, 0)
+			periods = append(periods, &ReportPeriod{Start: start, End: start.AddDate(0, months, 0)})
+			continue
+		}
+		start := last.Start.AddDate(0, 0, days*h)
+		periods = append(periods, &ReportPeriod{Start: start, End: start.AddDate(0, 0, days)})
+	}
+	return periods
+}
+
+// forecastPeriods returns the projected periods of the longest forecast of
+// the metrics, following the periods of the results.
+func (r *QueryRunner) forecastPeriods(periods []*ReportPeriod) []*ReportPeriod {
+	n := 0
+	for _, m := range r.Config.Metrics {
+		if !m.Disabled && m.Forecast != nil && m.Forecast.Periods > n {
+			n = m.Forecast.Periods
+		}
+	}
+	if n == 0 || len(periods) == 0 {
+		return nil
+	}
+	points := []*MetricPoint{}
+	for _, p := range periods {
+		points = append(points, &MetricPoint{Period: p})
+	}
+	return forecastPeriods(points, n)
+}
+
+// hasForecast returns true when any metric has a forecast.
+func (r *QueryRunner) hasForecast() bool {
+	for _, m := range r.Config.Metrics {
+		if !m.Disabled && m.Forecast != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package esqrunner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForecast(t *testing.T) {
+	start := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		name      string
+		config    *ForecastConfig
+		values    []interface{}
+		trend     string
+		slope     float64
+		projected []float64
+		dates     []string
+		delta     float64
+	}{
+		{
+			name:      "linear up",
+			config:    &ForecastConfig{Method: "linear", Periods: 2},
+			values:    []interface{}{10.0, 20.0, "err", 40.0},
+			trend:     "up",
+			slope:     10,
+			projected: []float64{50, 60},
+			dates:     []string{"2020-03-05", "2020-03-06"},
+		},
+		{
+			name:      "linear flat",
+			config:    &ForecastConfig{Method: "linear", Periods: 1},
+			values:    []interface{}{10.0, 12.0, 9.0, 11.0, 10.0},
+			trend:     "flat",
+			slope:     -0.1,
+			projected: []float64{10.1},
+		},
+		{
+			name:      "holt-winters seasonal down",
+			config:    &ForecastConfig{Method: "holt_winters", Season: 2, Periods: 2},
+			values:    []interface{}{30.0, 10.0, 28.0, 8.0, 26.0, 6.0, 24.0, 4.0},
+			trend:     "down",
+			slope:     -1,
+			projected: []float64{22, 2},
+			dates:     []string{"2020-03-09", "2020-03-10"},
+			delta:     0.15,
+		},
+	}
+	for _, tc := range testcases {
+		if err := tc.config.Validate(); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		f := forecast(testTransformPoints(start, tc.values...), tc.config)
+		if f == nil {
+			t.Fatalf("%s: no forecast", tc.name)
+		}
+		if tc.delta == 0 {
+			tc.delta = 0.01
+		}
+		if f.Trend != tc.trend || math.Abs(f.Slope-tc.slope) > tc.delta || len(f.Points) != len(tc.projected) {
+			t.Fatalf("%s: unexpected forecast: %+v", tc.name, f)
+		}
+		for i, p := range f.Points {
+			if math.Abs(p.Value-tc.projected[i]) > 1 || p.Lower > p.Value || p.Upper < p.Value {
+				t.Fatalf("%s: unexpected forecast point %d: %+v", tc.name, i, p)
+			}
+			if i < len(tc.dates) && p.Period.Start.Format("2006-01-02") != tc.dates[i] {
+				t.Fatalf("%s: unexpected forecast period %d: %+v", tc.name, i, p.Period)
+			}
+		}
+	}
+
+	monthly := applyTransforms(testTransformPoints(start, 10.0, 20.0, 30.0), []*TransformConfig{{Rollup: "month", Aggregate: "sum"}})
+	periods := forecastPeriods(monthly, 2)
+	if periods[1].Start.Format("2006-01-02") != "2020-05-01" || periods[1].End.Format("2006-01-02") != "2020-06-01" {
+		t.Fatalf("unexpected monthly forecast periods: %+v", periods[1])
+	}
+	if f := forecast(testTransformPoints(start, 10.0, 20.0), &ForecastConfig{Method: "linear", Periods: 1}); f != nil {
+		t.Fatalf("expected no forecast of two values: %+v", f)
+	}
+
+	for _, c := range []*ForecastConfig{
+		{},
+		{Method: "arima"},
+		{Method: "linear", Periods: -1},
+		{Method: "linear", Confidence: 1},
+		{Method: "holt_winters", Season: 1},
+		{Method: "holt_winters", Alpha: 2},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected forecast config %+v to fail validation", c)
+		}
+	}
+}
+
+func TestOutputForecast(t *testing.T) {
+	r := newTestOutputRunner(t)
+	m := r.Config.Metrics[0]
+	m.Forecast = &ForecastConfig{Method: "linear", Periods: 2}
+	if err := m.Forecast.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r.Metrics[m.ID] = []uint64{10, 20, 30}
+	r.MetricErrors[m.ID] = []error{nil, nil, nil}
+
+	r.Config.Output.Format = "json"
+	out, err := r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal([]byte(out), report); err != nil {
+		t.Fatal(err)
+	}
+	f := report.Metrics[0].Forecast
+	if f == nil || len(report.Metrics[0].Points) != 3 || len(f.Points) != 2 || f.Points[0].Value != 40 || f.Trend != "up" {
+		t.Fatalf("unexpected forecast:\n%s", out)
+	}
+
+	r.Config.Output.Format = "csv"
+	r.Config.Output.Statistics = []string{"total"}
+	for _, landscape := range []bool{true, false} {
+		r.Config.Output.Landscape = landscape
+		out, err = r.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr := csv.NewReader(strings.NewReader(out))
+		cr.Comma = ';'
+		records, err := cr.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if landscape {
+			header, row := strings.Join(records[0][5:10], ","), strings.Join(records[1][5:10], ",")
+			if header != "Forecast 2020/03/04,Forecast 2020/03/05,Forecast Slope,Forecast Trend,Total" || row != "40.00,50.00,10.00,up,60.00" {
+				t.Fatalf("unexpected forecast columns:\n%s", out)
+			}
+			continue
+		}
+		if len(records) != 6 || strings.Join(records[0][2:5], ",") != "Type,Lower,Upper" ||
+			records[3][2] != "observed" || strings.Join(records[5][:5], ",") != "2020/03/05,50.00,forecast,50.00,50.00" {
+			t.Fatalf("unexpected forecast rows:\n%s", out)
+		}
+	}
+
+	r.Config.Output.Format = "html"
+	if out, err = r.Output(); err != nil || !strings.Contains(out, "Forecast, linear: slope 10.00 per period, trend up") {
+		t.Fatalf("html output has no forecast: %v\n%s", err, out)
+	}
+}
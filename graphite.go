@@ -0,0 +1,120 @@
+package esqrunner
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var invalidGraphiteNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// graphitePath returns dotted path of a metric, built from the prefix,
+// the category and the name of the metric.
+func graphitePath(prefix string, m *Metric) string {
+	path := []string{}
+	for _, s := range []string{m.Category, m.Name} {
+		s = strings.Trim(invalidGraphiteNameChars.ReplaceAllString(strings.ToLower(s), "_"), "_")
+		if s == "" {
+			s = "_"
+		}
+		path = append(path, s)
+	}
+	if prefix != "" {
+		path = append([]string{strings.Trim(prefix, ".")}, path...)
+	}
+	return strings.Join(path, ".")
+}
+
+// outputGraphite writes metric data in Graphite plaintext protocol, with
+// the transformations of the output, if any.
+//
+// References:
+//
+// - [Feeding In Your Data](https://graphite.readthedocs.io/en/latest/feeding-carbon.html)
+func (r *QueryRunner) outputGraphite(sb *strings.Builder, prefix string, transforms []*TransformConfig) {
+	for _, m := range r.Config.Metrics {
+		if m.Disabled {
+			continue
+		}
+		path := graphitePath(prefix, m)
+		for _, p := range r.points(m, transforms) {
+			if p.Value == nil {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("%s %s %d\n", path, formatValue(*p.Value), p.Period.Start.Unix()))
+		}
+	}
+}
+
+// GraphiteOutputConfig is the configuration of the output sending metric
+// data to Graphite over TCP.
+type GraphiteOutputConfig struct {
+	Address      string `json:"addr" yaml:"addr"`
+	Prefix       string `json:"prefix" yaml:"prefix"`
+	Retries      int    `json:"retries" yaml:"retries"`
+	RetryBackoff string `json:"retry_backoff" yaml:"retry_backoff"`
+	Timeout      string `json:"timeout" yaml:"timeout"`
+	retryBackoff time.Duration
+	timeout      time.Duration
+}
+
+// Validate validates GraphiteOutputConfig.
+func (c *GraphiteOutputConfig) Validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("graphite output has no address")
+	}
+	if c.Prefix == "" {
+		c.Prefix = "esqrunner"
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("graphite output has negative retries")
+	}
+	if c.RetryBackoff == "" {
+		c.RetryBackoff = "1s"
+	}
+	if c.Timeout == "" {
+		c.Timeout = "10s"
+	}
+	var err error
+	if c.retryBackoff, err = time.ParseDuration(c.RetryBackoff); err != nil {
+		return fmt.Errorf("graphite output has invalid retry backoff: %s", err)
+	}
+	if c.timeout, err = time.ParseDuration(c.Timeout); err != nil {
+		return fmt.Errorf("graphite output has invalid timeout: %s", err)
+	}
+	return nil
+}
+
+func (r *QueryRunner) exportGraphite(cfg *GraphiteOutputConfig) error {
+	var sb strings.Builder
+	r.outputGraphite(&sb, cfg.Prefix, nil)
+	data := []byte(sb.String())
+	backoff := cfg.retryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= cfg.Retries; attempt++ {
+		if attempt > 0 {
+			log.Debugf("retrying graphite %s in %s, attempt %d: %s", cfg.Address, backoff, attempt, lastErr)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		conn, err := net.DialTimeout("tcp", cfg.Address, cfg.timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(cfg.timeout))
+		_, err = conn.Write(data)
+		if cerr := conn.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("graphite output failed sending to %s: %s", cfg.Address, lastErr)
+}
@@ -0,0 +1,338 @@
+package esqrunner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GroupingConfig is the configuration of the order and the grouping of the
+// metrics in tabular outputs, i.e. CSV, Markdown, HTML, XLSX and terminal
+// tables. The metrics are sorted by the key, which is either category, name,
+// or metadata.<key>, e.g. metadata.team, and keep the order of the metric
+// sources when the key is empty or the values are equal.
+//
+// With subtotals, the metrics are grouped by category, and the metrics of
+// each category are followed by the subtotal, i.e. the sums of their values.
+// The categories with the metrics of different units or scales, or with SLO
+// metrics, have no subtotals, since their values do not add up.
+// With pivot, the outputs have a pivot table instead of the metrics.
+type GroupingConfig struct {
+	SortBy    string       `json:"sort_by" yaml:"sort_by"`
+	Subtotals bool         `json:"subtotals" yaml:"subtotals"`
+	Pivot     *PivotConfig `json:"pivot" yaml:"pivot"`
+}
+
+// PivotConfig is the configuration of a pivot table. The rows and the
+// columns are the keys of the metrics, as the keys of sorting are, and the
+// columns are the names of the metrics by default. A cell aggregates the
+// values of the metrics of its row and column for the period of the date,
+// the last period by default, with sum, the default, avg, min, or max
+// aggregate.
+type PivotConfig struct {
+	Rows      string `json:"rows" yaml:"rows"`
+	Columns   string `json:"columns" yaml:"columns"`
+	Date      string `json:"date" yaml:"date"`
+	Aggregate string `json:"aggregate" yaml:"aggregate"`
+	date      time.Time
+}
+
+// pivotTable is a pivot table of the values of the metrics for a period.
+type pivotTable struct {
+	Title   string
+	Columns []string
+	Period  *ReportPeriod
+	Rows    []*pivotRow
+}
+
+// pivotRow is a row of a pivot table. The value of a cell is nil when the
+// metrics of the cell have no values. The metric of a cell has the unit and
+// the precision of the metrics of the cell, and is nil when they differ.
+type pivotRow struct {
+	Name    string
+	Values  []*float64
+	Metrics []*Metric
+}
+
+// Validate validates GroupingConfig.
+func (c *GroupingConfig) Validate() error {
+	if c.SortBy != "" && !validGroupingKey(c.SortBy) {
+		return fmt.Errorf("grouping sort key is unsupported: %s", c.SortBy)
+	}
+	if c.Pivot != nil {
+		if c.Subtotals {
+			return fmt.Errorf("grouping must have either subtotals or pivot, not both")
+		}
+		if err := c.Pivot.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate validates PivotConfig.
+func (c *PivotConfig) Validate() error {
+	if !validGroupingKey(c.Rows) {
+		return fmt.Errorf("pivot rows key is unsupported: %q", c.Rows)
+	}
+	if c.Columns == "" {
+		c.Columns = "name"
+	}
+	if !validGroupingKey(c.Columns) {
+		return fmt.Errorf("pivot columns key is unsupported: %q", c.Columns)
+	}
+	if c.Rows == c.Columns {
+		return fmt.Errorf("pivot rows and columns must have different keys: %s", c.Rows)
+	}
+	if c.Date != "" {
+		date, err := time.ParseInLocation("2006-01-02", c.Date, time.Local)
+		if err != nil {
+			return fmt.Errorf("pivot date is invalid: %s", err)
+		}
+		c.date = date
+	}
+	switch c.Aggregate {
+	case "":
+		c.Aggregate = "sum"
+	case "sum", "avg", "min", "max":
+	default:
+		return fmt.Errorf("pivot aggregate is unsupported: %s", c.Aggregate)
+	}
+	return nil
+}
+
+// validGroupingKey returns true when the key is category, name, or
+// metadata.<key>.
+func validGroupingKey(key string) bool {
+	switch key {
+	case "category", "name":
+		return true
+	}
+	return strings.HasPrefix(key, "metadata.") && len(key) > len("metadata.")
+}
+
+// groupingKeyTitle returns the title of the key in the headers, e.g. Team
+// for metadata.team.
+func groupingKeyTitle(key string) string {
+	if key == "name" {
+		return "Metric"
+	}
+	return strings.Title(strings.TrimPrefix(key, "metadata."))
+}
+
+// groupingValue returns the value of the key of a metric.
+func groupingValue(key string, m *MetricResult) string {
+	switch key {
+	case "category":
+		return m.Category
+	case "name":
+		return m.Name
+	}
+	return m.Metadata[strings.TrimPrefix(key, "metadata.")]
+}
+
+// rows returns the results in the order of the grouping, with the subtotal
+// following the results of each category when requested. The results keep
+// their order without grouping.
+func (c *GroupingConfig) rows(results []*MetricResult) []*MetricResult {
+	if c == nil {
+		return results
+	}
+	sorted := append([]*MetricResult{}, results...)
+	if c.SortBy != "" {
+		// The metrics without the metadata key follow the others.
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, b := groupingValue(c.SortBy, sorted[i]), groupingValue(c.SortBy, sorted[j])
+			if a == "" || b == "" {
+				return a != "" && b == ""
+			}
+			return a < b
+		})
+	}
+	if !c.Subtotals {
+		return sorted
+	}
+	rows := []*MetricResult{}
+	for _, category := range (&Report{Metrics: sorted}).Categories() {
+		rows = append(rows, category.Metrics...)
+		if sub := subtotal(category.Name, category.Metrics); sub != nil {
+			rows = append(rows, sub)
+		}
+	}
+	return rows
+}
+
+// sharedUnit returns the metric with the unit, the currency and the scale
+// of the metrics, and with their precision when they share it, or nil when
+// the metrics have different units or scales.
+func sharedUnit(metrics []*Metric) *Metric {
+	var shared *Metric
+	for _, metric := range metrics {
+		if shared == nil {
+			shared = &Metric{Unit: metric.Unit, Currency: metric.Currency, Scale: metric.Scale, Precision: metric.Precision}
+			continue
+		}
+		if metric.Unit != shared.Unit || metric.Currency != shared.Currency || metric.scale() != shared.scale() {
+			return nil
+		}
+		if metric.Precision == nil || shared.Precision == nil || *metric.Precision != *shared.Precision {
+			shared.Precision = nil
+		}
+	}
+	return shared
+}
+
+// subtotal returns the result of the sums of the values of the metrics per
+// period. The periods without values in every metric have no value, and
+// the periods with any filled value are filled. The subtotal has the unit
+// and the precision of the metrics when they share them, and is nil when
+// the metrics have different units or scales, or are SLO metrics.
+func subtotal(category string, results []*MetricResult) *MetricResult {
+	metrics := []*Metric{}
+	for _, res := range results {
+		metric := res.Metric()
+		if metric == nil || metric.SLO != nil {
+			return nil
+		}
+		metrics = append(metrics, metric)
+	}
+	shared := sharedUnit(metrics)
+	if shared == nil {
+		return nil
+	}
+	m := &Metric{Category: category, Name: "Subtotal", Metadata: map[string]string{}, Unit: shared.Unit, Currency: shared.Currency, Precision: shared.Precision}
+	points := []*MetricPoint{}
+	for _, res := range results {
+		for i, p := range res.Points {
+			if i == len(points) {
+				points = append(points, &MetricPoint{Period: p.Period, Error: "no data"})
+			}
+			if p.Value == nil {
+				continue
+			}
+			if points[i].Value == nil {
+				v := 0.0
+				points[i].Value, points[i].Error = &v, ""
+			}
+			*points[i].Value += *p.Value
+			if p.Filled {
+				points[i].Filled = true
+			}
+		}
+	}
+	return &MetricResult{
+		Category: category,
+		Name:     m.Name,
+		Metadata: m.Metadata,
+		Points:   points,
+		Summary:  summarize(points),
+		metric:   m,
+		subtotal: true,
+	}
+}
+
+// pivot returns the pivot table of the results. The rows and the columns are
+// in the order of their first appearance in the results.
+func (c *PivotConfig) pivot(periods []*ReportPeriod, results []*MetricResult) (*pivotTable, error) {
+	if len(periods) == 0 {
+		return nil, fmt.Errorf("pivot has no periods")
+	}
+	index := len(periods) - 1
+	if !c.date.IsZero() {
+		index = -1
+		for i, p := range periods {
+			// The date is the midnight in the location of the periods.
+			date := time.Date(c.date.Year(), c.date.Month(), c.date.Day(), 0, 0, 0, 0, p.Start.Location())
+			if !date.Before(p.Start) && date.Before(p.End) {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("pivot date is not in the periods: %s", c.Date)
+		}
+	}
+	table := &pivotTable{Title: groupingKeyTitle(c.Rows), Columns: []string{}, Period: periods[index], Rows: []*pivotRow{}}
+	columns, rows := map[string]int{}, map[string]*pivotRow{}
+	cells := map[[2]string][]float64{}
+	cellMetrics := map[[2]string][]*Metric{}
+	for _, res := range results {
+		row, column := groupingValue(c.Rows, res), groupingValue(c.Columns, res)
+		if row == "" {
+			row = "-"
+		}
+		if column == "" {
+			column = "-"
+		}
+		if _, exists := columns[column]; !exists {
+			columns[column] = len(table.Columns)
+			table.Columns = append(table.Columns, column)
+		}
+		if _, exists := rows[row]; !exists {
+			rows[row] = &pivotRow{Name: row}
+			table.Rows = append(table.Rows, rows[row])
+		}
+		if index < len(res.Points) && res.Points[index].Value != nil {
+			cells[[2]string{row, column}] = append(cells[[2]string{row, column}], *res.Points[index].Value)
+			if metric := res.Metric(); metric != nil {
+				cellMetrics[[2]string{row, column}] = append(cellMetrics[[2]string{row, column}], metric)
+			}
+		}
+	}
+	for _, row := range table.Rows {
+		for _, column := range table.Columns {
+			values := cells[[2]string{row.Name, column}]
+			if len(values) == 0 {
+				row.Values, row.Metrics = append(row.Values, nil), append(row.Metrics, nil)
+				continue
+			}
+			v := c.aggregate(values)
+			var metric *Metric
+			if metrics := cellMetrics[[2]string{row.Name, column}]; len(metrics) == len(values) {
+				metric = sharedUnit(metrics)
+			}
+			row.Values, row.Metrics = append(row.Values, &v), append(row.Metrics, metric)
+		}
+	}
+	return table, nil
+}
+
+// aggregate returns the aggregate of the values of a cell.
+func (c *PivotConfig) aggregate(values []float64) float64 {
+	v := values[0]
+	for _, x := range values[1:] {
+		switch c.Aggregate {
+		case "min":
+			v = math.Min(v, x)
+		case "max":
+			v = math.Max(v, x)
+		default:
+			v += x
+		}
+	}
+	if c.Aggregate == "avg" {
+		v /= float64(len(values))
+	}
+	return v
+}
+
+// pivotText returns the text of a cell of a pivot table, with the
+// precision and the unit of the metric of the cell, as the values of the
+// metrics have.
+func pivotText(m *Metric, v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return m.formatUnit(*v, "")
+}
+
+// groupedRows returns the results of the report in the order of the
+// grouping of the output, or the pivot table when the grouping has one.
+func (opts *renderOptions) groupedRows(report *Report) ([]*MetricResult, *pivotTable, error) {
+	if opts.Grouping == nil || opts.Grouping.Pivot == nil {
+		return opts.Grouping.rows(report.Metrics), nil, nil
+	}
+	table, err := opts.Grouping.Pivot.pivot(report.Periods, opts.Grouping.rows(report.Metrics))
+	return nil, table, err
+}
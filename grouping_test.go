@@ -0,0 +1,366 @@
+package esqrunner
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestGroupingRunner returns QueryRunner with metric data for three days
+// of three metrics in two categories.
+func newTestGroupingRunner(t *testing.T) *QueryRunner {
+	r := newTestOutputRunner(t)
+	m := r.Config.Metrics[0]
+	m.Metadata = map[string]string{"team": "B"}
+	alpha, alerts := *m, *m
+	alpha.ID, alpha.Name, alpha.Metadata = "alpha", "Alpha", map[string]string{"team": "A"}
+	alerts.ID, alerts.Category, alerts.Name, alerts.Metadata = "alerts", "Security", "Alerts", map[string]string{"team": "A"}
+	r.Config.Metrics = append(r.Config.Metrics, &alpha, &alerts)
+	r.Metrics[alpha.ID], r.Metrics[alerts.ID] = []uint64{1, 2, 3}, []uint64{5, 5, 5}
+	r.MetricErrors[alpha.ID], r.MetricErrors[alerts.ID] = []error{nil, nil, nil}, []error{nil, nil, nil}
+	return r
+}
+
+func TestGrouping(t *testing.T) {
+	invalid := []*GroupingConfig{
+		{SortBy: "team"},
+		{SortBy: "metadata."},
+		{Subtotals: true, Pivot: &PivotConfig{Rows: "category"}},
+		{Pivot: &PivotConfig{}},
+		{Pivot: &PivotConfig{Rows: "name"}},
+		{Pivot: &PivotConfig{Rows: "category", Date: "03/01/2020"}},
+		{Pivot: &PivotConfig{Rows: "category", Aggregate: "median"}},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected error for grouping: %v", *c)
+		}
+	}
+
+	r := newTestGroupingRunner(t)
+	report := r.Report()
+	name := r.Config.Metrics[0].Name
+	testcases := []struct {
+		name     string
+		grouping *GroupingConfig
+		expected []string
+	}{
+		{name: "no grouping", expected: []string{name, "Alpha", "Alerts"}},
+		{name: "sort by name", grouping: &GroupingConfig{SortBy: "name"}, expected: []string{"Alerts", "Alpha", name}},
+		{name: "sort by metadata", grouping: &GroupingConfig{SortBy: "metadata.team"}, expected: []string{"Alpha", "Alerts", name}},
+		{name: "sort by missing metadata", grouping: &GroupingConfig{SortBy: "metadata.tier"}, expected: []string{name, "Alpha", "Alerts"}},
+		{
+			name:     "subtotals",
+			grouping: &GroupingConfig{SortBy: "name", Subtotals: true},
+			expected: []string{"Alerts", "Subtotal", "Alpha", name, "Subtotal"},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			names := []string{}
+			for _, res := range tc.grouping.rows(report.Metrics) {
+				names = append(names, res.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+				t.Fatalf("unexpected order: %v, expected: %v", names, tc.expected)
+			}
+		})
+	}
+
+	rows := (&GroupingConfig{Subtotals: true}).rows(report.Metrics)
+	sub := rows[2]
+	if !sub.Subtotal() || sub.Category != "Helpdesk" || len(sub.Points) != 3 {
+		t.Fatalf("unexpected subtotal: %+v", sub)
+	}
+	for i, expected := range []float64{11, 2, 33} {
+		if v := sub.Points[i].Value; v == nil || *v != expected {
+			t.Fatalf("unexpected subtotal value %d: %v, expected: %v", i, v, expected)
+		}
+	}
+	if sub.Summary.Total != 46 {
+		t.Fatalf("unexpected subtotal summary: %+v", sub.Summary)
+	}
+
+	// The values of different units or scales, and the attainments, do not
+	// add up.
+	alpha := r.Config.Metrics[1]
+	for _, change := range []func(){
+		func() { alpha.Unit = "bytes" },
+		func() { alpha.Scale = 0.5 },
+		func() { alpha.Type, alpha.SLO = "slo", &SLOConfig{GoodMetric: "a", TotalMetric: "b", Target: 99} },
+	} {
+		alpha.Unit, alpha.Scale, alpha.Type, alpha.SLO = "", 0, "", nil
+		change()
+		rows := (&GroupingConfig{Subtotals: true}).rows(r.Report().Metrics)
+		if len(rows) != 4 || rows[1].Subtotal() || !rows[3].Subtotal() {
+			t.Fatalf("expected no subtotal of metrics %+v", alpha)
+		}
+	}
+	alpha.Unit, alpha.Scale, alpha.Type, alpha.SLO = "", 0, "", nil
+
+	pivots := []struct {
+		config   *PivotConfig
+		columns  []string
+		expected []string
+	}{
+		{
+			config:   &PivotConfig{Rows: "metadata.team"},
+			columns:  []string{name, "Alpha", "Alerts"},
+			expected: []string{"B: 30 - -", "A: - 3 5"},
+		},
+		{
+			config:   &PivotConfig{Rows: "metadata.team", Columns: "category", Date: "2020-03-02"},
+			columns:  []string{"Helpdesk", "Security"},
+			expected: []string{"B: - -", "A: 2 5"},
+		},
+		{
+			config:   &PivotConfig{Rows: "category", Columns: "metadata.team", Aggregate: "max"},
+			columns:  []string{"B", "A"},
+			expected: []string{"Helpdesk: 30 3", "Security: - 5"},
+		},
+	}
+	for _, tc := range pivots {
+		if err := tc.config.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		table, err := tc.config.pivot(report.Periods, report.Metrics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := []string{}
+		for _, row := range table.Rows {
+			values := []string{}
+			for i, v := range row.Values {
+				values = append(values, pivotText(row.Metrics[i], v))
+			}
+			lines = append(lines, row.Name+": "+strings.Join(values, " "))
+		}
+		if strings.Join(table.Columns, ",") != strings.Join(tc.columns, ",") || strings.Join(lines, ",") != strings.Join(tc.expected, ",") {
+			t.Fatalf("unexpected pivot: %v %v, expected: %v %v", table.Columns, lines, tc.columns, tc.expected)
+		}
+	}
+	c := &PivotConfig{Rows: "category", Date: "2020-04-01"}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.pivot(report.Periods, report.Metrics); err == nil {
+		t.Fatalf("expected error for pivot date out of periods")
+	}
+}
+
+func TestPivotDateLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database is not available: %s", err)
+	}
+	local := time.Local
+	time.Local = loc
+	defer func() { time.Local = local }()
+
+	r := newTestGroupingRunner(t)
+	for i := range r.Config.Timestamps {
+		r.Config.Timestamps[i] = time.Date(2020, time.March, 1+i, 0, 0, 0, 0, time.Local)
+	}
+	report := r.Report()
+	c := &PivotConfig{Rows: "category", Date: "2020-03-02"}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	table, err := c.pivot(report.Periods, report.Metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !table.Period.Start.Equal(r.Config.Timestamps[1]) {
+		t.Fatalf("unexpected pivot period: %v", table.Period.Start)
+	}
+}
+
+func TestOutputGrouping(t *testing.T) {
+	r := newTestGroupingRunner(t)
+	r.Config.Output.Grouping = &GroupingConfig{SortBy: "name", Subtotals: true}
+	r.Config.Output.Statistics = []string{"total"}
+	r.Config.Output.Format = "csv"
+	for _, landscape := range []bool{true, false} {
+		r.Config.Output.Landscape = landscape
+		out, err := r.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr := csv.NewReader(strings.NewReader(out))
+		cr.Comma = ';'
+		records, err := cr.ReadAll()
+		if err != nil {
+			t.Fatalf("malformed csv: %s\n%s", err, out)
+		}
+		if landscape {
+			last := records[len(records)-1]
+			if len(records) != 6 || records[2][1] != "Subtotal" || strings.Join(last[:6], ",") != "Helpdesk,Subtotal,11,2,33,46.00" {
+				t.Fatalf("unexpected landscape csv:\n%s", out)
+			}
+			continue
+		}
+		if len(records) != 16 || strings.Join(records[15][:4], ",") != "2020/03/03,33,Helpdesk,Subtotal" {
+			t.Fatalf("unexpected portrait csv:\n%s", out)
+		}
+	}
+
+	r.Config.Output.Format = "markdown"
+	out, err := r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "| Helpdesk | **Subtotal** | 11 | 2 | 33 | 46.00 |") {
+		t.Fatalf("unexpected markdown:\n%s", out)
+	}
+
+	r.Config.Output.Format = "html"
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out, `<div class="metric subtotal"`) != 2 {
+		t.Fatalf("html output has no subtotals:\n%s", out)
+	}
+
+	r.Config.Output.Format = "xlsx"
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := xlsxFile(t, out, "xl/worksheets/sheet3.xml")
+	for _, s := range []string{`<c r="A4" s="1" t="inlineStr"><is><t xml:space="preserve">Subtotal</t>`, `<c r="B4" s="4"><f>SUM(B2:B3)</f><v>11</v></c>`} {
+		if !strings.Contains(sheet, s) {
+			t.Fatalf("worksheet has no %s:\n%s", s, sheet)
+		}
+	}
+	summary := xlsxFile(t, out, "xl/worksheets/sheet1.xml")
+	if !strings.Contains(summary, `<c r="B2" s="4"><v>1</v></c>`) || !strings.Contains(summary, `<c r="B3" s="4"><v>2</v></c>`) {
+		t.Fatalf("summary has subtotals counted as metrics:\n%s", summary)
+	}
+	if !strings.Contains(summary, `<c r="C3" s="4"><v>11</v></c>`) || !strings.Contains(summary, `<c r="F3" s="4"><v>46</v></c>`) {
+		t.Fatalf("summary has no category totals:\n%s", summary)
+	}
+
+	// The category totals have the number format of the metrics, and are
+	// blank with mixed units or SLO metrics.
+	precision := 1
+	for _, m := range r.Config.Metrics[:2] {
+		m.Unit, m.Precision = "seconds", &precision
+	}
+	if out, err = r.Output(); err != nil {
+		t.Fatal(err)
+	}
+	if summary := xlsxFile(t, out, "xl/worksheets/sheet1.xml"); !strings.Contains(summary, `<c r="F3" s="5"><v>46</v></c>`) {
+		t.Fatalf("summary has no formatted category totals:\n%s", summary)
+	}
+	r.Config.Metrics[1].Unit = "ms"
+	if out, err = r.Output(); err != nil {
+		t.Fatal(err)
+	}
+	if summary := xlsxFile(t, out, "xl/worksheets/sheet1.xml"); strings.Contains(summary, `r="C3"`) || !strings.Contains(summary, `<c r="C2" s="4"><v>5</v></c>`) {
+		t.Fatalf("summary expected blank totals with mixed units:\n%s", summary)
+	}
+	r.Config.Metrics[1].Unit = "seconds"
+	r.Config.Metrics[0].SLO = &SLOConfig{}
+	if out, err = r.Output(); err != nil {
+		t.Fatal(err)
+	}
+	r.Config.Metrics[0].SLO = nil
+	if summary := xlsxFile(t, out, "xl/worksheets/sheet1.xml"); strings.Contains(summary, `r="C3"`) {
+		t.Fatalf("summary expected blank totals with SLO metrics:\n%s", summary)
+	}
+	for _, m := range r.Config.Metrics[:2] {
+		m.Unit, m.Precision = "", nil
+	}
+
+	r.Config.Output.Grouping = &GroupingConfig{Pivot: &PivotConfig{Rows: "metadata.team", Columns: "category"}}
+	if err := r.Config.Output.Grouping.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"csv":      {"Team;Helpdesk;Security\n", "B;30;-\n", "A;3;5\n"},
+		"markdown": {"| Team | Helpdesk | Security |\n", "| B | 30 | - |\n", "| A | 3 | 5 |\n"},
+		"table":    {"Team  Helpdesk  Security\n", "B           30         -\n", "A            3         5\n"},
+		"html":     {"<h2>Team, 2020-03-03</h2>", "<tr><td>A</td><td>3</td><td>5</td></tr>"},
+	}
+	for format, lines := range expected {
+		r.Config.Output.Format = format
+		out, err := r.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range lines {
+			if !strings.Contains(out, s) {
+				t.Fatalf("%s pivot has no %q:\n%s", format, s, out)
+			}
+		}
+	}
+	r.Config.Output.Format = "xlsx"
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workbook := xlsxFile(t, out, "xl/workbook.xml"); !strings.Contains(workbook, `<sheet name="Pivot"`) || !strings.Contains(workbook, `<sheet name="Summary"`) || !strings.Contains(workbook, `<sheet name="Helpdesk"`) {
+		t.Fatalf("unexpected pivot workbook: %s", workbook)
+	}
+
+	// The cells have the units and the precisions of their metrics.
+	precision = 1
+	for _, m := range r.Config.Metrics {
+		m.Unit, m.Precision = "seconds", &precision
+	}
+	expected = map[string][]string{
+		"csv":      {"B;30.0;-\n", "A;3.0;5.0\n"},
+		"markdown": {"| B | 30.0 s | - |\n"},
+		"table":    {"30.0 s"},
+		"html":     {"<tr><td>A</td><td>3.0 s</td><td>5.0 s</td></tr>"},
+	}
+	for format, lines := range expected {
+		r.Config.Output.Format = format
+		out, err := r.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range lines {
+			if !strings.Contains(out, s) {
+				t.Fatalf("%s pivot has no %q:\n%s", format, s, out)
+			}
+		}
+	}
+	r.Config.Output.Format = "xlsx"
+	if out, err = r.Output(); err != nil {
+		t.Fatal(err)
+	}
+	if sheet := xlsxFile(t, out, "xl/worksheets/sheet4.xml"); !strings.Contains(sheet, `<c r="B2" s="5"><v>30</v></c>`) {
+		t.Fatalf("unexpected pivot worksheet: %s", sheet)
+	}
+}
+
+// xlsxFile returns the content of a file of an XLSX workbook.
+func xlsxFile(t *testing.T, workbook, name string) string {
+	zr, err := zip.NewReader(strings.NewReader(workbook), int64(len(workbook)))
+	if err != nil {
+		t.Fatalf("malformed xlsx: %s", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	t.Fatal(fmt.Errorf("xlsx has no %s", name))
+	return ""
+}
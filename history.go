@@ -0,0 +1,233 @@
+package esqrunner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const historyFileName = "history.ndjson"
+
+// HistoryConfig is the configuration of the durable metric history.
+type HistoryConfig struct {
+	Dir          string `json:"dir" yaml:"dir"`
+	SettleWindow string `json:"settle_window" yaml:"settle_window"`
+	ReadOnly     bool   `json:"-" yaml:"-"`
+	settleWindow time.Duration
+}
+
+// Validate validates HistoryConfig.
+func (c *HistoryConfig) Validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("history config has no directory")
+	}
+	if c.SettleWindow == "" {
+		c.SettleWindow = "0s"
+	}
+	d, err := time.ParseDuration(c.SettleWindow)
+	if err != nil {
+		return fmt.Errorf("history config has invalid settle window: %s", err)
+	}
+	if d < 0 {
+		return fmt.Errorf("history config has negative settle window: %s", c.SettleWindow)
+	}
+	c.settleWindow = d
+	log.Debugf("history directory: %s, settle window: %s", c.Dir, c.settleWindow)
+	return nil
+}
+
+// Settled returns true when the daily period starting at the provided
+// timestamp closed longer than the settle window ago.
+func (c *HistoryConfig) Settled(ts, now time.Time) bool {
+	return periodSettled(ts, now, c.settleWindow)
+}
+
+// HistoryRecord is the value of a metric for a period.
+type HistoryRecord struct {
+	MetricID   string    `json:"metric_id"`
+	Period     string    `json:"period"`
+	Value      uint64    `json:"value"`
+	QueryHash  string    `json:"query_hash"`
+	Cluster    string    `json:"cluster,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// HistoryStore is an append-only store of metric values, kept in
+// a newline-delimited JSON file. The records are kept per metric, period
+// and cluster, so that the clusters sharing the file have their own values.
+type HistoryStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	records map[string]map[string]map[string]*HistoryRecord
+}
+
+// OpenHistoryStore returns HistoryStore stored in the provided directory.
+func OpenHistoryStore(dir string) (*HistoryStore, error) {
+	dir, err := expandHomePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed creating history directory %s: %s", dir, err)
+	}
+	h := &HistoryStore{
+		path:    filepath.Join(dir, historyFileName),
+		records: make(map[string]map[string]map[string]*HistoryRecord),
+	}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	h.file, err = os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.truncateTail(); err != nil {
+		h.file.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// truncateTail truncates the file back to its last complete line. A run
+// interrupted while writing leaves a partial record without the trailing
+// newline, and the records appended after it would be concatenated to it.
+func (h *HistoryStore) truncateTail() error {
+	info, err := h.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := h.file.ReadAt(chunk, start); err != nil {
+			return fmt.Errorf("failed reading history file %s: %s", h.path, err)
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			size = start + int64(i) + 1
+			break
+		}
+		end, size = start, start
+	}
+	if size == info.Size() {
+		return nil
+	}
+	log.Warnf("truncated partial history record at the end of %s", h.path)
+	if err := h.file.Truncate(size); err != nil {
+		return fmt.Errorf("failed truncating history file %s: %s", h.path, err)
+	}
+	return nil
+}
+
+func (h *HistoryStore) load() error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var count, lineNum int
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		rec := &HistoryRecord{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			// A partially written record is left behind by an interrupted run.
+			log.Warnf("skipped malformed history record at %s:%d: %s", h.path, lineNum, err)
+			continue
+		}
+		h.add(rec)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed reading history file %s: %s", h.path, err)
+	}
+	log.Debugf("loaded %d history records from %s", count, h.path)
+	return nil
+}
+
+func (h *HistoryStore) add(rec *HistoryRecord) {
+	if _, exists := h.records[rec.MetricID]; !exists {
+		h.records[rec.MetricID] = make(map[string]map[string]*HistoryRecord)
+	}
+	if _, exists := h.records[rec.MetricID][rec.Period]; !exists {
+		h.records[rec.MetricID][rec.Period] = make(map[string]*HistoryRecord)
+	}
+	h.records[rec.MetricID][rec.Period][rec.Cluster] = rec
+}
+
+// Get returns the recorded value of a metric for the period starting at
+// the provided timestamp in the cluster. The records made with a different
+// query are ignored. When the cluster is unknown, i.e. the history is read
+// without connecting to Elasticsearch, the record is returned only when a
+// single cluster recorded the period.
+func (h *HistoryStore) Get(m *Metric, ts time.Time, cluster string) (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clusters, exists := h.records[m.ID][ts.Format("2006-01-02")]
+	if !exists {
+		return 0, false
+	}
+	rec, exists := clusters[cluster]
+	if !exists && cluster == "" && len(clusters) == 1 {
+		for _, r := range clusters {
+			rec, exists = r, true
+		}
+	}
+	if !exists || rec.QueryHash != metricQueryHash(m) {
+		return 0, false
+	}
+	return rec.Value, true
+}
+
+// Append durably records the value of a metric for the period starting at
+// the provided timestamp.
+func (h *HistoryStore) Append(m *Metric, ts time.Time, value uint64, cluster string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec := &HistoryRecord{
+		MetricID:   m.ID,
+		Period:     ts.Format("2006-01-02"),
+		Value:      value,
+		QueryHash:  metricQueryHash(m),
+		Cluster:    cluster,
+		RecordedAt: time.Now().UTC(),
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := h.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed writing history file %s: %s", h.path, err)
+	}
+	if err := h.file.Sync(); err != nil {
+		return fmt.Errorf("failed syncing history file %s: %s", h.path, err)
+	}
+	h.add(rec)
+	return nil
+}
+
+// Close closes the history file.
+func (h *HistoryStore) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
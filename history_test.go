@@ -0,0 +1,142 @@
+package esqrunner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryBackfill(t *testing.T) {
+	counts := map[string]uint64{
+		"tickets-20200301": 10,
+		"tickets-20200302": 20,
+	}
+	srv := newTestElasticsearch(t, counts)
+	dir := t.TempDir()
+	from := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, time.March, 3, 0, 0, 0, 0, time.UTC)
+
+	r := newTestRunner(t, srv.URL)
+	r.Config.History = &HistoryConfig{Dir: dir}
+	if err := r.Backfill(from, to, 2); err != nil {
+		t.Fatalf("backfill failed: %s", err)
+	}
+
+	counts["tickets-20200303"] = 30
+	r = newTestRunner(t, srv.URL)
+	r.Config.History = &HistoryConfig{Dir: dir}
+	if err := r.Backfill(from, to, 2); err != nil {
+		t.Fatalf("backfill failed: %s", err)
+	}
+	if r.Summary.Queries != 1 {
+		t.Fatalf("expected resumed backfill to query only the gap, summary: %s", r.Summary)
+	}
+	id := "28e3c0fb594443fea16131c5f26eeb81"
+	if len(r.Metrics[id]) != len(r.Config.Timestamps) || r.Metrics[id][0] != 10 || r.Metrics[id][2] != 30 {
+		t.Fatalf("backfill values are not aligned with timestamps: %v", r.Metrics[id])
+	}
+	srv.Close()
+
+	r = newTestRunner(t, srv.URL)
+	r.Config.History = &HistoryConfig{Dir: dir, ReadOnly: true}
+	if err := r.Run(); err != nil {
+		t.Fatalf("run from history failed: %s", err)
+	}
+	for i, v := range []uint64{10, 20, 30} {
+		if r.MetricErrors[id][i] != nil || r.Metrics[id][i] != v {
+			t.Fatalf("history value mismatch at %d, expected: %d, received: %d, %v", i, v, r.Metrics[id][i], r.MetricErrors[id][i])
+		}
+	}
+}
+
+func TestHistoryClusters(t *testing.T) {
+	dir := t.TempDir()
+	h, err := OpenHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Metric{ID: "tickets"}
+	ts := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if err := h.Append(m, ts, 10, "cluster-a"); err != nil {
+		t.Fatal(err)
+	}
+	if v, hit := h.Get(m, ts, ""); !hit || v != 10 {
+		t.Fatalf("expected the value of the single cluster, received: %d, %t", v, hit)
+	}
+	if err := h.Append(m, ts, 20, "cluster-b"); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+
+	h, err = OpenHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	for cluster, expected := range map[string]uint64{"cluster-a": 10, "cluster-b": 20} {
+		if v, hit := h.Get(m, ts, cluster); !hit || v != expected {
+			t.Fatalf("unexpected value of %s: %d, %t, expected: %d", cluster, v, hit, expected)
+		}
+	}
+	if _, hit := h.Get(m, ts, "cluster-c"); hit {
+		t.Fatalf("expected no value of another cluster")
+	}
+	if _, hit := h.Get(m, ts, ""); hit {
+		t.Fatalf("expected no value when the cluster is ambiguous")
+	}
+}
+
+func TestHistoryPartialRecord(t *testing.T) {
+	dir := t.TempDir()
+	h, err := OpenHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Metric{ID: "tickets"}
+	ts := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if err := h.Append(m, ts, 10, ""); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+
+	// An interrupted run leaves a record without the trailing newline.
+	fp := filepath.Join(dir, historyFileName)
+	f, err := os.OpenFile(fp, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"metric_id":"tickets","period":"2020-03-0`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	h, err = OpenHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Append(m, ts.AddDate(0, 0, 1), 20, ""); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+
+	h, err = OpenHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	for i, expected := range []uint64{10, 20} {
+		if v, hit := h.Get(m, ts.AddDate(0, 0, i), ""); !hit || v != expected {
+			t.Fatalf("unexpected value of day %d: %d, %t, expected: %d", i, v, hit, expected)
+		}
+	}
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 || strings.Contains(string(data), `"2020-03-0"`) {
+		t.Fatalf("unexpected history file:\n%s", data)
+	}
+}
@@ -0,0 +1,222 @@
+package esqrunner
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292e; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; border-bottom: 1px solid #e1e4e8; padding-bottom: .3em; margin-top: 2em; }
+.run { color: #586069; font-size: .9em; }
+.metric { border: 1px solid #e1e4e8; border-radius: 6px; padding: 1em; margin: 1em 0; }
+.metric h3 { margin: 0 0 .3em 0; font-size: 1.1em; }
+.metric .description { color: #586069; margin: 0 0 .5em 0; }
+.metric.has-errors { border-color: #d73a49; }
+.metric.subtotal { background: #f6f8fa; }
+table.pivot td:first-child { text-align: left; }
+.metadata span { display: inline-block; background: #f1f8ff; border-radius: 3px; padding: 0 .4em; margin-right: .3em; font-size: .85em; }
+table { border-collapse: collapse; font-size: .85em; margin-top: .5em; }
+th, td { border: 1px solid #e1e4e8; padding: .2em .5em; text-align: right; }
+th { background: #f6f8fa; }
+td.error { background: #ffeef0; color: #d73a49; }
+td.filled { color: #6a737d; font-style: italic; }
+td.anomaly { background: #fff5b1; font-weight: bold; }
+.forecast { color: #6f42c1; }
+.slo { font-size: .9em; }
+.slo .warning { color: #b08800; font-weight: bold; }
+.slo .critical { color: #d73a49; font-weight: bold; }
+table.forecast td { font-style: italic; }
+table.forecast td.band { color: #6a737d; font-size: .9em; }
+.errors { color: #d73a49; font-size: .85em; }
+.evaluation td { text-align: left; }
+tr.warning td { background: #fffbdd; }
+tr.critical td { background: #ffeef0; color: #d73a49; }
+svg .line { fill: none; stroke: #0366d6; stroke-width: 2; }
+svg .point { fill: #0366d6; }
+svg .missing { fill: #d73a49; }
+svg .axis { stroke: #e1e4e8; }
+svg text { font-size: 10px; fill: #586069; }
+#filter { padding: .3em; width: 20em; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p class="run">Run {{ .Report.Run.ID }}{{ if .Report.Run.StartedAt }}, started {{ .Report.Run.StartedAt.Format "2006-01-02 15:04:05 MST" }}{{ end }}{{ if .Report.Run.ClusterVersion }}, Elasticsearch {{ .Report.Run.ClusterVersion }}{{ end }}, configuration {{ .Report.Run.ConfigHash }}</p>
+{{ with .Report.Evaluation }}
+<section class="evaluation">
+<h2>Evaluation: {{ .Status }}</h2>
+<table>
+<tr><th>Category</th><th>Metric</th><th>Rule</th><th>Value</th><th>Level</th></tr>
+{{ range .Results }}<tr class="{{ .Level }}"><td>{{ .Category }}</td><td>{{ .Name }}</td><td>{{ .Rule }}</td><td>{{ if .Value }}{{ .Value }}{{ else }}-{{ end }}</td><td>{{ .Level }}</td></tr>
+{{ end }}</table>
+</section>
+{{ end }}
+{{ with .Pivot }}
+<section class="pivot">
+<h2>{{ .Title }}, {{ .Period.Start.Format "2006-01-02" }}</h2>
+<table class="pivot">
+<tr><th>{{ .Title }}</th>{{ range .Columns }}<th>{{ . }}</th>{{ end }}</tr>
+{{ range $row := .Rows }}<tr><td>{{ .Name }}</td>{{ range $i, $v := .Values }}<td>{{ pivot (index $row.Metrics $i) $v }}</td>{{ end }}</tr>
+{{ end }}</table>
+</section>
+{{ else }}
+<p><input id="filter" type="search" placeholder="Filter metrics" oninput="filterMetrics(this.value)"></p>
+{{ range .Categories }}
+<section class="category">
+<h2>{{ .Name }}</h2>
+{{ range .Metrics }}
+<div class="metric{{ if .Subtotal }} subtotal{{ end }}{{ if hasErrors . }} has-errors{{ end }}" data-name="{{ lower .Name }}">{{ $metric := . }}
+<h3>{{ .Name }}</h3>
+<p class="description">{{ .Metric.Description }}</p>
+{{ with .SLO }}<p class="slo">Target {{ number .Target }}% over {{ .Window }} days: attainment {{ if .Attainment }}{{ number .Attainment }}%{{ else }}-{{ end }}, error budget remaining {{ if .BudgetRemaining }}{{ number .BudgetRemaining }}%{{ else }}-{{ end }}, burn rate {{ if .BurnRate }}{{ number .BurnRate }}{{ else }}-{{ end }}{{ if .Partial }}, partial window of {{ .Days }} days{{ end }}{{ range .Alerts }}{{ if .Fired }}, <span class="{{ .Alert.Level }}">{{ .Alert.Level }} burn rate alert</span>{{ end }}{{ end }}</p>{{ end }}
+{{ if .Metadata }}<p class="metadata">{{ range $k, $v := .Metadata }}<span>{{ $k }}: {{ $v }}</span>{{ end }}</p>{{ end }}
+{{ chart . }}
+<table>
+<tr>{{ range .Points }}<th>{{ .Period.Start.Format "2006-01-02" }}</th>{{ end }}{{ range $.Statistics }}<th>{{ .Title }}</th>{{ end }}</tr>
+<tr>{{ range .Points }}{{ if .Value }}<td{{ if .Anomaly }} class="anomaly" title="{{ .Anomaly.Method }} {{ anomaly .Anomaly }}"{{ else if .Filled }} class="filled" title="{{ .Error }}"{{ end }}>{{ value $metric .Value }}</td>{{ else }}<td class="error" title="{{ .Error }}">-</td>{{ end }}{{ end }}{{ $summary := .Summary }}{{ range $.Statistics }}<td>{{ statistic $metric . $summary }}</td>{{ end }}</tr>
+</table>
+{{ with .Forecast }}
+<p class="forecast">Forecast, {{ .Method }}: slope {{ quantity $metric .Slope }} per period, trend {{ .Trend }}</p>
+<table class="forecast">
+<tr>{{ range .Points }}<th>{{ .Period.Start.Format "2006-01-02" }}</th>{{ end }}</tr>
+<tr>{{ range .Points }}<td>{{ quantity $metric .Value }}</td>{{ end }}</tr>
+<tr>{{ range .Points }}<td class="band">{{ quantity $metric .Lower }} to {{ quantity $metric .Upper }}</td>{{ end }}</tr>
+</table>
+{{ end }}
+{{ if hasErrors . }}<ul class="errors">{{ range .Points }}{{ if .Error }}<li>{{ .Period.Start.Format "2006-01-02" }}: {{ .Error }}</li>{{ end }}{{ end }}</ul>{{ end }}
+</div>
+{{ end }}
+</section>
+{{ end }}
+{{ end }}
+<script>
+function filterMetrics(s) {
+  s = s.toLowerCase();
+  document.querySelectorAll(".metric").forEach(function (el) {
+    el.style.display = el.getAttribute("data-name").indexOf(s) >= 0 ? "" : "none";
+  });
+  document.querySelectorAll(".category").forEach(function (el) {
+    var visible = Array.prototype.some.call(el.querySelectorAll(".metric"), function (m) { return m.style.display !== "none"; });
+    el.style.display = visible ? "" : "none";
+  });
+}
+</script>
+</body>
+</html>
+`
+
+// svgChart returns a line chart of the values of a metric. The periods
+// without values are marked on the horizontal axis.
+func svgChart(m *MetricResult) template.HTML {
+	const width, height, pad = 600.0, 120.0, 20.0
+	var max float64
+	for _, p := range m.Points {
+		if p.Value != nil && *p.Value > max {
+			max = *p.Value
+		}
+	}
+	n := len(m.Points)
+	x := func(i int) float64 {
+		if n < 2 {
+			return width / 2
+		}
+		return pad + float64(i)*(width-2*pad)/float64(n-1)
+	}
+	y := func(v float64) float64 {
+		if max == 0 {
+			return height - pad
+		}
+		return height - pad - v*(height-2*pad)/max
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" role="img">`, width, height, width, height))
+	sb.WriteString(fmt.Sprintf(`<line class="axis" x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f"/>`, pad, height-pad, width-pad, height-pad))
+	sb.WriteString(fmt.Sprintf(`<text x="2" y="%.0f">%s</text><text x="2" y="%.0f">0</text>`, pad-6, formatValue(max), height-pad+12))
+	segment := []string{}
+	flush := func() {
+		if len(segment) > 1 {
+			sb.WriteString(`<polyline class="line" points="` + strings.Join(segment, " ") + `"/>`)
+		}
+		segment = []string{}
+	}
+	for i, p := range m.Points {
+		if p.Value == nil {
+			flush()
+			continue
+		}
+		segment = append(segment, fmt.Sprintf("%.1f,%.1f", x(i), y(*p.Value)))
+	}
+	flush()
+	for i, p := range m.Points {
+		date := p.Period.Start.Format("2006-01-02")
+		if p.Value == nil {
+			sb.WriteString(fmt.Sprintf(`<circle class="missing" cx="%.1f" cy="%.1f" r="3"><title>%s: %s</title></circle>`, x(i), height-pad, date, template.HTMLEscapeString(p.Error)))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(`<circle class="point" cx="%.1f" cy="%.1f" r="2.5"><title>%s: %s</title></circle>`, x(i), y(*p.Value), date, formatValue(*p.Value)))
+	}
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
+
+func hasErrors(m *MetricResult) bool {
+	for _, p := range m.Points {
+		if p.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlStatistic is a summary statistic of the HTML report.
+type htmlStatistic struct {
+	Title string
+	stat  *summaryStatistic
+}
+
+// outputHTML writes metric data as a self-contained HTML report. The values
+// have the precision and the unit of their metrics. With pivot, the report
+// has the pivot table instead of the metrics.
+func (r *QueryRunner) outputHTML(w io.Writer, opts *renderOptions) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"anomaly":   anomalyText,
+		"chart":     svgChart,
+		"hasErrors": hasErrors,
+		"lower":     strings.ToLower,
+		"pivot":     pivotText,
+		"number":    func(v float64) string { return fmt.Sprintf("%.2f", v) },
+		"quantity":  func(m *MetricResult, v float64) string { return m.Metric().formatUnit(v, "%.2f") },
+		"statistic": func(m *MetricResult, st *htmlStatistic, s *MetricSummary) string {
+			return m.Metric().statisticText(st.stat, s, "%.2f", true)
+		},
+		"value": func(m *MetricResult, v *float64) string { return m.Metric().formatUnit(*v, "") },
+	}).Parse(htmlReportTemplate)
+	if err != nil {
+		return err
+	}
+	report := r.report(opts.Transforms)
+	results, pivot, err := opts.groupedRows(report)
+	if err != nil {
+		return err
+	}
+	stats := []*htmlStatistic{}
+	for _, st := range selectStatistics(opts.Statistics, htmlStatistics) {
+		stats = append(stats, &htmlStatistic{Title: st.title, stat: st})
+	}
+	return tmpl.Execute(w, map[string]interface{}{
+		"Title":      "Metrics Report",
+		"Report":     report,
+		"Categories": (&Report{Metrics: results}).Categories(),
+		"Pivot":      pivot,
+		"Statistics": stats,
+	})
+}
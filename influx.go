@@ -0,0 +1,116 @@
+package esqrunner
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+var influxTagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+
+// influxTags returns the tags of a metric: category, metric ID and metadata,
+// sorted by key.
+func influxTags(m *Metric) string {
+	tags := map[string]string{
+		"category":  m.Category,
+		"metric_id": m.ID,
+	}
+	for k, v := range m.Metadata {
+		if _, exists := tags[k]; exists {
+			continue
+		}
+		tags[k] = v
+	}
+	keys := []string{}
+	for k, v := range tags {
+		// The tags with empty values are not allowed.
+		if v == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString("," + influxTagEscaper.Replace(k) + "=" + influxTagEscaper.Replace(tags[k]))
+	}
+	return sb.String()
+}
+
+// outputInflux writes metric data in InfluxDB line protocol, with the
+// transformations of the output, if any. The metric name is the measurement,
+// and the periods are nanosecond timestamps. The
+// value field is always a float, so that the filled and the scaled values
+// are not truncated, and the type of the field does not change across runs.
+// The points of the metrics with anomaly detection have the anomaly field,
+// and the flagged points the anomaly_baseline and anomaly_score fields.
+//
+// References:
+//
+// - [Line protocol](https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/)
+func (r *QueryRunner) outputInflux(sb *strings.Builder, transforms []*TransformConfig) {
+	for _, m := range r.Config.Metrics {
+		if m.Disabled {
+			continue
+		}
+		prefix := influxMeasurementEscaper.Replace(m.Name) + influxTags(m)
+		for _, p := range r.points(m, transforms) {
+			if p.Value == nil {
+				continue
+			}
+			fields := "value=" + formatValue(*p.Value)
+			if a := p.Anomaly; a != nil {
+				fields += fmt.Sprintf(",anomaly=true,anomaly_baseline=%s,anomaly_score=%s", formatValue(a.Baseline), formatValue(a.Score))
+			} else if m.Anomaly != nil {
+				fields += ",anomaly=false"
+			}
+			sb.WriteString(fmt.Sprintf("%s %s %d\n", prefix, fields, p.Period.Start.UnixNano()))
+		}
+	}
+}
+
+// InfluxOutputConfig is the configuration of the output writing metric
+// data to InfluxDB v2 write API.
+type InfluxOutputConfig struct {
+	PushConfig `yaml:",inline"`
+	Org        string `json:"org" yaml:"org"`
+	Bucket     string `json:"bucket" yaml:"bucket"`
+	Token      string `json:"token" yaml:"token"`
+}
+
+// Validate validates InfluxOutputConfig.
+func (c *InfluxOutputConfig) Validate() error {
+	if err := c.PushConfig.validate("influx"); err != nil {
+		return err
+	}
+	if c.Bucket == "" {
+		return fmt.Errorf("influx output has no bucket")
+	}
+	return nil
+}
+
+// exportInflux writes metric data to InfluxDB.
+//
+// References:
+//
+// - [Write data with the InfluxDB API](https://docs.influxdata.com/influxdb/v2/write-data/developer-tools/api/)
+func (r *QueryRunner) exportInflux(cfg *InfluxOutputConfig) error {
+	var sb strings.Builder
+	r.outputInflux(&sb, nil)
+	params := url.Values{}
+	params.Set("bucket", cfg.Bucket)
+	params.Set("precision", "ns")
+	if cfg.Org != "" {
+		params.Set("org", cfg.Org)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	if cfg.Token != "" {
+		header.Set("Authorization", "Token "+cfg.Token)
+	}
+	u := strings.TrimRight(cfg.URL, "/") + "/api/v2/write?" + params.Encode()
+	return cfg.send(http.MethodPost, u, header, []byte(sb.String()))
+}
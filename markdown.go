@@ -0,0 +1,156 @@
+package esqrunner
+
+import (
+	"io"
+	"strings"
+)
+
+var sparklineBars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline returns the values of a metric as a string of Unicode bars.
+// The periods without values are blank.
+func sparkline(m *MetricResult) string {
+	var min, max float64
+	first := true
+	for _, p := range m.Points {
+		if p.Value == nil {
+			continue
+		}
+		if first || *p.Value < min {
+			min = *p.Value
+		}
+		if first || *p.Value > max {
+			max = *p.Value
+		}
+		first = false
+	}
+	var sb strings.Builder
+	for _, p := range m.Points {
+		if p.Value == nil {
+			sb.WriteRune(' ')
+			continue
+		}
+		i := 0
+		if max > min {
+			i = int((*p.Value - min) * float64(len(sparklineBars)-1) / (max - min))
+		}
+		sb.WriteRune(sparklineBars[i])
+	}
+	return sb.String()
+}
+
+func escapeMarkdownCell(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Replace(strings.Replace(s, "\r\n", " ", -1), "\n", " ", -1)
+}
+
+// outputMarkdown writes metric data as GitHub Flavored Markdown table in
+// landscape layout. The values have the precision and the unit of their
+// metrics, and the subtotals are in bold. With pivot, the table is the pivot
+// table.
+//
+// References:
+//
+// - [GitHub Flavored Markdown Spec - Tables](https://github.github.com/gfm/#tables-extension-)
+func (r *QueryRunner) outputMarkdown(w io.Writer, opts *renderOptions) error {
+	report := r.report(opts.Transforms)
+	results, pivot, err := opts.groupedRows(report)
+	if err != nil {
+		return err
+	}
+	if pivot != nil {
+		_, err := io.WriteString(w, markdownPivot(pivot))
+		return err
+	}
+	stats := selectStatistics(opts.Statistics, markdownStatistics)
+	header := []string{"Category", "Metric"}
+	align := []string{":---", ":---"}
+	for _, k := range r.Config.Metadata.FieldList {
+		header = append(header, escapeMarkdownCell(strings.Title(k)))
+		align = append(align, ":---")
+	}
+	for _, p := range report.Periods {
+		header = append(header, p.Start.Format("2006-01-02"))
+		align = append(align, "---:")
+	}
+	for _, st := range stats {
+		header = append(header, escapeMarkdownCell(st.title))
+		align = append(align, "---:")
+	}
+	header = append(header, "Trend")
+	align = append(align, ":---")
+
+	var sb strings.Builder
+	sb.WriteString("| " + strings.Join(header, " | ") + " |\n")
+	sb.WriteString("| " + strings.Join(align, " | ") + " |\n")
+	for _, m := range results {
+		line := []string{escapeMarkdownCell(m.Category), escapeMarkdownCell(m.Name)}
+		if m.Subtotal() {
+			line[1] = "**" + line[1] + "**"
+		}
+		for _, k := range r.Config.Metadata.FieldList {
+			if v, exists := m.Metadata[k]; exists {
+				line = append(line, escapeMarkdownCell(v))
+			} else {
+				line = append(line, "-")
+			}
+		}
+		metric := m.Metric()
+		for _, p := range m.Points {
+			if p.Value == nil {
+				line = append(line, r.missingValue(metric))
+				continue
+			}
+			if p.Anomaly != nil {
+				line = append(line, "**"+escapeMarkdownCell(metric.formatUnit(*p.Value, ""))+"**")
+				continue
+			}
+			line = append(line, escapeMarkdownCell(metric.formatUnit(*p.Value, "")))
+		}
+		for _, st := range stats {
+			line = append(line, escapeMarkdownCell(metric.statisticText(st, m.Summary, "%.2f", true)))
+		}
+		line = append(line, "`"+sparkline(m)+"`")
+		sb.WriteString("| " + strings.Join(line, " | ") + " |\n")
+	}
+	if report.Evaluation != nil {
+		sb.WriteString("\n**Evaluation: " + report.Evaluation.Status + "**\n\n")
+		sb.WriteString("| Category | Metric | Rule | Value | Level |\n")
+		sb.WriteString("| :--- | :--- | :--- | ---: | :--- |\n")
+		for _, res := range report.Evaluation.Results {
+			value := "-"
+			if res.Value != nil {
+				value = formatValue(*res.Value)
+			}
+			line := []string{
+				escapeMarkdownCell(res.Category), escapeMarkdownCell(res.Name),
+				escapeMarkdownCell(res.Rule.String()), value, res.Level,
+			}
+			sb.WriteString("| " + strings.Join(line, " | ") + " |\n")
+		}
+	}
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// markdownPivot returns a pivot table as GitHub Flavored Markdown table.
+func markdownPivot(table *pivotTable) string {
+	header := []string{escapeMarkdownCell(table.Title)}
+	align := []string{":---"}
+	for _, c := range table.Columns {
+		header = append(header, escapeMarkdownCell(c))
+		align = append(align, "---:")
+	}
+	var sb strings.Builder
+	sb.WriteString("| " + strings.Join(header, " | ") + " |\n")
+	sb.WriteString("| " + strings.Join(align, " | ") + " |\n")
+	for _, row := range table.Rows {
+		line := []string{escapeMarkdownCell(row.Name)}
+		for i, v := range row.Values {
+			line = append(line, escapeMarkdownCell(pivotText(row.Metrics[i], v)))
+		}
+		sb.WriteString("| " + strings.Join(line, " | ") + " |\n")
+	}
+	return sb.String()
+}
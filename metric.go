@@ -10,6 +10,7 @@ import (
 var supportedOperations map[string]bool
 var supportedIndexSplit map[string]bool
 var supportedFuctions map[string]bool
+var supportedMissingData map[string]bool
 
 func init() {
 	supportedOperations = make(map[string]bool)
@@ -18,22 +19,40 @@ func init() {
 	supportedOperations["GET"] = true
 	supportedIndexSplit["daily"] = true
 	supportedFuctions["_count"] = true
+	supportedMissingData = map[string]bool{
+		"skip":        true,
+		"zero":        true,
+		"null":        true,
+		"previous":    true,
+		"interpolate": true,
+	}
 }
 
 // Metric is a collection of attrbutes and parameters
 // for the creation and management of a metric.
 type Metric struct {
-	ID          string            `json:"id" yaml:"id"`
-	Category    string            `json:"category" yaml:"category"`
-	Name        string            `json:"name" yaml:"name"`
-	Description string            `json:"description" yaml:"description"`
-	Metadata    map[string]string `json:"metadata" yaml:"metadata"`
-	Operation   string            `json:"operation" yaml:"operation"`
-	BaseIndex   string            `json:"base_index" yaml:"base_index"`
-	IndexSplit  string            `json:"index_split" yaml:"index_split"`
-	Function    string            `json:"dsl_function" yaml:"dsl_function"`
-	Query       *json.RawMessage  `json:"dsl_query" yaml:"dsl_query"`
-	Disabled    bool              `json:"disabled" yaml:"disabled"`
+	ID          string             `json:"id" yaml:"id"`
+	Category    string             `json:"category" yaml:"category"`
+	Name        string             `json:"name" yaml:"name"`
+	Description string             `json:"description" yaml:"description"`
+	Metadata    map[string]string  `json:"metadata" yaml:"metadata"`
+	Operation   string             `json:"operation" yaml:"operation"`
+	BaseIndex   string             `json:"base_index" yaml:"base_index"`
+	IndexSplit  string             `json:"index_split" yaml:"index_split"`
+	Function    string             `json:"dsl_function" yaml:"dsl_function"`
+	Query       *json.RawMessage   `json:"dsl_query" yaml:"dsl_query"`
+	Disabled    bool               `json:"disabled" yaml:"disabled"`
+	MissingData string             `json:"missing_data,omitempty" yaml:"missing_data"`
+	Transforms  []*TransformConfig `json:"transforms,omitempty" yaml:"transforms"`
+	Thresholds  []*ThresholdRule   `json:"thresholds,omitempty" yaml:"thresholds"`
+	Anomaly     *AnomalyConfig     `json:"anomaly,omitempty" yaml:"anomaly"`
+	Forecast    *ForecastConfig    `json:"forecast,omitempty" yaml:"forecast"`
+	Type        string             `json:"type,omitempty" yaml:"type"`
+	SLO         *SLOConfig         `json:"slo,omitempty" yaml:"slo"`
+	Unit        string             `json:"unit,omitempty" yaml:"unit"`
+	Currency    string             `json:"currency,omitempty" yaml:"currency"`
+	Scale       float64            `json:"scale,omitempty" yaml:"scale"`
+	Precision   *int               `json:"precision,omitempty" yaml:"precision"`
 }
 
 // NewMetricsFromFile parses a JSON file containing metrics, and
@@ -80,6 +99,35 @@ func (m *Metric) Valid() error {
 	if m.Description == "" {
 		return fmt.Errorf("attribute Description not set in %v", *m)
 	}
+	switch m.Type {
+	case "", "count":
+		if m.SLO != nil {
+			return fmt.Errorf("attribute SLO requires slo type, metric: %v", *m)
+		}
+	case "slo":
+		if m.SLO == nil {
+			return fmt.Errorf("attribute SLO not set in %v", *m)
+		}
+		if err := m.SLO.Validate(); err != nil {
+			return fmt.Errorf("attribute SLO is invalid: %s, metric: %v", err, *m)
+		}
+	default:
+		return fmt.Errorf("attribute Type has unsupported value: %s, metric: %v", m.Type, *m)
+	}
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]string)
+	}
+	// The SLO metrics referencing other metrics are not queried.
+	if m.SLO == nil || m.SLO.GoodQuery != nil {
+		if err := m.validQuery(); err != nil {
+			return err
+		}
+	}
+	return m.validOptions()
+}
+
+// validQuery validates the attributes of the query of a metric.
+func (m *Metric) validQuery() error {
 	if m.Operation == "" {
 		return fmt.Errorf("attribute Operation not set in %v", *m)
 	}
@@ -92,9 +140,6 @@ func (m *Metric) Valid() error {
 	if m.Function == "" {
 		return fmt.Errorf("attribute Function not set in %v", *m)
 	}
-	if m.Metadata == nil {
-		m.Metadata = make(map[string]string)
-	}
 	if _, supported := supportedOperations[m.Operation]; !supported {
 		return fmt.Errorf(
 			"attribute Operation has unsupported value: %s, metric: %v",
@@ -115,3 +160,35 @@ func (m *Metric) Valid() error {
 	}
 	return nil
 }
+
+// validOptions validates the options of the series of a metric.
+func (m *Metric) validOptions() error {
+	if m.MissingData != "" {
+		if _, supported := supportedMissingData[m.MissingData]; !supported {
+			return fmt.Errorf(
+				"attribute MissingData has unsupported value: %s, metric: %v",
+				m.MissingData, *m,
+			)
+		}
+	}
+	if err := m.validUnit(); err != nil {
+		return err
+	}
+	if err := validateTransforms(m.Transforms, false); err != nil {
+		return fmt.Errorf("attribute Transforms is invalid: %s, metric: %v", err, *m)
+	}
+	if err := validateThresholds(m.Thresholds); err != nil {
+		return fmt.Errorf("attribute Thresholds is invalid: %s, metric: %v", err, *m)
+	}
+	if m.Anomaly != nil {
+		if err := m.Anomaly.Validate(); err != nil {
+			return fmt.Errorf("attribute Anomaly is invalid: %s, metric: %v", err, *m)
+		}
+	}
+	if m.Forecast != nil {
+		if err := m.Forecast.Validate(); err != nil {
+			return fmt.Errorf("attribute Forecast is invalid: %s, metric: %v", err, *m)
+		}
+	}
+	return nil
+}
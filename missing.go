@@ -0,0 +1,140 @@
+package esqrunner
+
+import (
+	"strconv"
+	"time"
+)
+
+// missingDataPolicy returns the policy for the periods of a metric which
+// could not be collected. The policy of the metric takes precedence over
+// the policy in the runner configuration.
+//
+// The policies are:
+//
+// - skip: the points have no value, and the outputs leave them out
+// - null: the points have no value, and the outputs write empty values
+// - zero: the points have zero value
+// - previous: the points have the value of the previous valid point
+// - interpolate: the points have the value on the line between the
+// adjacent valid points
+//
+// With previous and interpolate policies, the points before the first and
+// after the last valid point have no value.
+func (r *QueryRunner) missingDataPolicy(m *Metric) string {
+	if m.MissingData != "" {
+		return m.MissingData
+	}
+	if r.Config.MissingData != "" {
+		return r.Config.MissingData
+	}
+	return "skip"
+}
+
+// points returns the data points of a metric, one per period. The values of
+// the periods which could not be collected are filled according to the
+// missing data policy of the metric, the points are transformed, with the
+// transformations of the output being rendered, if any, and the transformed
+// points are checked for anomalies.
+func (r *QueryRunner) points(m *Metric, output []*TransformConfig) []*MetricPoint {
+	return r.pointsOf(m, r.Config.Timestamps, output)
+}
+
+// pointsOf returns the data points of a metric for the first periods of the
+// run, as points does for all of them.
+func (r *QueryRunner) pointsOf(m *Metric, timestamps []time.Time, output []*TransformConfig) []*MetricPoint {
+	points := r.fillPoints(m, timestamps, r.Metrics, r.MetricErrors)
+	points = applyTransforms(points, r.transformsOf(m, output))
+	detectAnomalies(points, m.Anomaly)
+	return points
+}
+
+// fillPoints returns the data points of the collected values and errors.
+// The values are multiplied by the scale of the metric.
+func (r *QueryRunner) fillPoints(m *Metric, timestamps []time.Time, metrics map[string][]uint64, metricErrors map[string][]error) []*MetricPoint {
+	values, errs := seriesOf(m, metrics, metricErrors)
+	points := []*MetricPoint{}
+	for i, ts := range timestamps {
+		points = append(points, seriesPoint(m, ts, values, errs, i))
+	}
+
+	switch r.missingDataPolicy(m) {
+	case "zero":
+		for _, p := range points {
+			if p.Value == nil {
+				v := 0.0
+				p.Value, p.Filled = &v, true
+			}
+		}
+	case "previous":
+		var prev *float64
+		for _, p := range points {
+			if p.Value == nil && prev != nil {
+				v := *prev
+				p.Value, p.Filled = &v, true
+			}
+			prev = p.Value
+		}
+	case "interpolate":
+		last := -1
+		for i, p := range points {
+			if p.Value == nil {
+				continue
+			}
+			if last >= 0 && i-last > 1 {
+				from, to := *points[last].Value, *p.Value
+				for j := last + 1; j < i; j++ {
+					v := from + (to-from)*float64(j-last)/float64(i-last)
+					points[j].Value, points[j].Filled = &v, true
+				}
+			}
+			last = i
+		}
+	}
+	return points
+}
+
+// seriesPoint returns the data point of the period of a collected value of
+// a metric. The value is multiplied by the scale of the metric.
+func seriesPoint(m *Metric, ts time.Time, values []float64, errs []error, i int) *MetricPoint {
+	point := &MetricPoint{Period: periodOf(ts)}
+	switch {
+	case i >= len(values):
+		point.Error = "no data"
+	case errs[i] != nil:
+		point.Error = errs[i].Error()
+	default:
+		v := values[i] * m.scale()
+		point.Value = &v
+	}
+	return point
+}
+
+// validValues returns the values of the points, and the number of points
+// excluded, i.e. the points without value and the points with the values
+// filled according to the missing data policy.
+func validValues(points []*MetricPoint) ([]float64, int) {
+	values := []float64{}
+	excluded := 0
+	for _, p := range points {
+		if p.Value == nil || p.Filled {
+			excluded++
+			continue
+		}
+		values = append(values, *p.Value)
+	}
+	return values, excluded
+}
+
+// formatValue returns the shortest representation of a value, e.g. 10 or
+// 10.5.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// missingValue returns the text of a point without value in tabular outputs.
+func (r *QueryRunner) missingValue(m *Metric) string {
+	if r.missingDataPolicy(m) == "null" {
+		return ""
+	}
+	return "-"
+}
@@ -0,0 +1,98 @@
+package esqrunner
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMissingDataPolicy(t *testing.T) {
+	r := newTestOutputRunner(t)
+	m := r.Config.Metrics[0]
+	r.Config.Timestamps = append(r.Config.Timestamps, r.Config.Timestamps[2].AddDate(0, 0, 1), r.Config.Timestamps[2].AddDate(0, 0, 2))
+	r.Metrics[m.ID] = []uint64{10, 0, 30, 0, 40}
+	r.MetricErrors[m.ID] = []error{nil, fmt.Errorf("timeout"), nil, fmt.Errorf("timeout"), nil}
+
+	testcases := []struct {
+		policy string
+		values []interface{}
+		filled int
+	}{
+		{policy: "skip", values: []interface{}{10.0, nil, 30.0, nil, 40.0}},
+		{policy: "null", values: []interface{}{10.0, nil, 30.0, nil, 40.0}},
+		{policy: "zero", values: []interface{}{10.0, 0.0, 30.0, 0.0, 40.0}, filled: 2},
+		{policy: "previous", values: []interface{}{10.0, 10.0, 30.0, 30.0, 40.0}, filled: 2},
+		{policy: "interpolate", values: []interface{}{10.0, 20.0, 30.0, 35.0, 40.0}, filled: 2},
+	}
+	for _, tc := range testcases {
+		m.MissingData = tc.policy
+		result := r.Report().Metrics[0]
+		values := []interface{}{}
+		for _, p := range result.Points {
+			if p.Value == nil {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, *p.Value)
+		}
+		if !reflect.DeepEqual(values, tc.values) {
+			t.Fatalf("%s policy: unexpected values %v, expected %v", tc.policy, values, tc.values)
+		}
+		s := result.Summary
+		// The statistics are computed over the collected values only.
+		if s.Total != 80 || s.Min != 10 || s.Mean != 80.0/3 || s.Excluded != 2 || s.Valid != 3 || s.Missing != 2 || s.Filled != tc.filled {
+			t.Fatalf("%s policy: unexpected summary %+v", tc.policy, s)
+		}
+		if tc.policy == "previous" && (!result.Points[1].Filled || result.Points[1].Error == "") {
+			t.Fatalf("%s policy: filled point has no flag or error: %+v", tc.policy, result.Points[1])
+		}
+	}
+
+	m.MissingData = "interpolate"
+	r.Config.Output.Format = "xlsx"
+	out, err := r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet := xlsxFile(t, out, "xl/worksheets/sheet2.xml"); strings.Contains(sheet, "SUM(") || !strings.Contains(sheet, "<v>80</v>") {
+		t.Fatalf("expected total without formula over filled values:\n%s", sheet)
+	}
+
+	m.MissingData = "null"
+	r.Config.Output.Format = "openmetrics"
+	r.Config.Output.Timestamps = true
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out, " NaN ") != 2 {
+		t.Fatalf("null policy expected NaN samples:\n%s", out)
+	}
+
+	// The periods after the last collected value follow the policy too.
+	m.MissingData = "previous"
+	r.Metrics[m.ID], r.MetricErrors[m.ID] = []uint64{10, 20}, []error{nil, nil}
+	r.Config.Output.Format = "csv"
+	r.Config.Output.Landscape = false
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 6 || !strings.HasPrefix(lines[5], "2020/03/05;20;") {
+		t.Fatalf("expected rows for every period:\n%s", out)
+	}
+	r.Config.Output.Format = "ndjson"
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out, `"value":20,"filled":true,"error":"no data"`) != 3 {
+		t.Fatalf("expected records for every period:\n%s", out)
+	}
+
+	m.MissingData = "average"
+	if err := m.Valid(); err == nil {
+		t.Fatalf("expected unsupported missing data policy to fail validation")
+	}
+}
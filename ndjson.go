@@ -0,0 +1,90 @@
+package esqrunner
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// MetricRecord is the value of a metric for a period, written as a line
+// of NDJSON output.
+type MetricRecord struct {
+	RunID    string            `json:"run_id"`
+	MetricID string            `json:"metric_id"`
+	Category string            `json:"category"`
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Unit     *MetricUnit       `json:"unit,omitempty"`
+	Period   *ReportPeriod     `json:"period"`
+	Value    *float64          `json:"value"`
+	Filled   bool              `json:"filled,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Anomaly  *PointAnomaly     `json:"anomaly,omitempty"`
+}
+
+func newMetricRecord(runID string, m *Metric, p *MetricPoint) *MetricRecord {
+	return &MetricRecord{
+		RunID:    runID,
+		MetricID: m.ID,
+		Category: m.Category,
+		Name:     m.Name,
+		Metadata: m.Metadata,
+		Unit:     m.unit(),
+		Period:   p.Period,
+		Value:    p.Value,
+		Filled:   p.Filled,
+		Error:    p.Error,
+		Anomaly:  p.Anomaly,
+	}
+}
+
+// NDJSONWriter writes metric records as newline-delimited JSON. It is safe
+// for concurrent use.
+type NDJSONWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter returns an instance of NDJSONWriter.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes a record on a single line.
+func (w *NDJSONWriter) Write(rec *MetricRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(rec)
+}
+
+// outputNDJSON writes a record per metric and period. The records are in
+// the order of the periods, and then of the metrics, as they are streamed
+// while the results arrive.
+func (r *QueryRunner) outputNDJSON(w io.Writer, opts *renderOptions) error {
+	nw := NewNDJSONWriter(w)
+	metrics := []*Metric{}
+	series := [][]*MetricPoint{}
+	periods := 0
+	for _, m := range r.Config.Metrics {
+		if m.Disabled {
+			continue
+		}
+		points := r.points(m, opts.Transforms)
+		if len(points) > periods {
+			periods = len(points)
+		}
+		metrics = append(metrics, m)
+		series = append(series, points)
+	}
+	for i := 0; i < periods; i++ {
+		for j, m := range metrics {
+			if i >= len(series[j]) {
+				continue
+			}
+			if err := nw.Write(newMetricRecord(r.RunID, m, series[j][i])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package esqrunner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// ElasticsearchOutputConfig is the configuration of the output indexing
+// metric data into Elasticsearch index or data stream.
+type ElasticsearchOutputConfig struct {
+	Address    []string `json:"addr" yaml:"addr"`
+	Index      string   `json:"index" yaml:"index"`
+	DataStream bool     `json:"data_stream" yaml:"data_stream"`
+	BatchSize  int      `json:"batch_size" yaml:"batch_size"`
+}
+
+// Validate validates ElasticsearchOutputConfig. When the output has no
+// address, it indexes into the queried Elasticsearch instance.
+func (c *ElasticsearchOutputConfig) Validate(rc *RunnerConfig) error {
+	if c.Index == "" {
+		return fmt.Errorf("elasticsearch output has no index")
+	}
+	if len(c.Address) == 0 && rc.Elasticsearch != nil {
+		c.Address = rc.Elasticsearch.Address
+	}
+	if len(c.Address) == 0 {
+		return fmt.Errorf("elasticsearch output has no address")
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 500
+	}
+	if c.BatchSize < 0 {
+		return fmt.Errorf("elasticsearch output has negative batch size")
+	}
+	return nil
+}
+
+// MetricDocument is the Elasticsearch document holding the value of
+// a metric for a period. The documents of the points flagged as anomalous
+// have the anomaly flag, the baseline and the score.
+type MetricDocument struct {
+	Timestamp time.Time         `json:"@timestamp"`
+	RunID     string            `json:"run_id"`
+	MetricID  string            `json:"metric_id"`
+	Category  string            `json:"category"`
+	Name      string            `json:"name"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Value     float64           `json:"value"`
+	Period    string            `json:"period"`
+	Anomaly   bool              `json:"anomaly,omitempty"`
+	Baseline  *float64          `json:"anomaly_baseline,omitempty"`
+	Score     *float64          `json:"anomaly_score,omitempty"`
+}
+
+// ID returns deterministic document ID, so that re-runs overwrite the
+// documents indexed previously.
+func (d *MetricDocument) ID() string {
+	h := sha256.New()
+	h.Write([]byte(d.MetricID + "|" + d.Period))
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func (r *QueryRunner) metricDocuments() []*MetricDocument {
+	docs := []*MetricDocument{}
+	for _, m := range r.Config.Metrics {
+		if m.Disabled {
+			continue
+		}
+		for _, p := range r.points(m, nil) {
+			if p.Value == nil {
+				continue
+			}
+			start := p.Period.Start
+			doc := &MetricDocument{
+				Timestamp: start,
+				RunID:     r.RunID,
+				MetricID:  m.ID,
+				Category:  m.Category,
+				Name:      m.Name,
+				Metadata:  m.Metadata,
+				Value:     *p.Value,
+				Period:    start.Format("2006-01-02"),
+			}
+			if a := p.Anomaly; a != nil {
+				doc.Anomaly = true
+				doc.Baseline, doc.Score = &a.Baseline, &a.Score
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+func (r *QueryRunner) exportElasticsearch(cfg *ElasticsearchOutputConfig) error {
+	client, err := NewElasticsearchClient(&ElasticsearchConfig{Address: cfg.Address})
+	if err != nil {
+		return err
+	}
+	action := "index"
+	if cfg.DataStream {
+		action = "create"
+	}
+	docs := r.metricDocuments()
+	var indexed int
+	for i := 0; i < len(docs); i += cfg.BatchSize {
+		j := i + cfg.BatchSize
+		if j > len(docs) {
+			j = len(docs)
+		}
+		var buf bytes.Buffer
+		for _, doc := range docs[i:j] {
+			meta := map[string]map[string]string{action: {"_id": doc.ID()}}
+			metaData, err := json.Marshal(meta)
+			if err != nil {
+				return err
+			}
+			docData, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			buf.Write(metaData)
+			buf.WriteByte('\n')
+			buf.Write(docData)
+			buf.WriteByte('\n')
+		}
+		result, err := client.Bulk(cfg.Index, buf.Bytes(), cfg.DataStream)
+		if err != nil {
+			return err
+		}
+		if result.Failed > 0 {
+			return fmt.Errorf(
+				"elasticsearch output failed indexing %d documents into %s: %s",
+				result.Failed, cfg.Index, strings.Join(result.Errors, ", "),
+			)
+		}
+		indexed += result.Indexed
+	}
+	log.Debugf("indexed %d documents into %s", indexed, cfg.Index)
+	return nil
+}
@@ -0,0 +1,118 @@
+package esqrunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestElasticsearchOutput(t *testing.T) {
+	ids := map[string]int{}
+	var docs []*MetricDocument
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if req.URL.Path == "/" {
+			fmt.Fprintf(w, `{"version":{"number":"7.17.10","build_flavor":"default"},"tagline":"You Know, for Search"}`)
+			return
+		}
+		if req.URL.Path != "/metrics-test/_bulk" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		scanner := bufio.NewScanner(req.Body)
+		items := []string{}
+		for scanner.Scan() {
+			action := map[string]map[string]string{}
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				t.Errorf("malformed action: %s", err)
+			}
+			id := action["index"]["_id"]
+			ids[id]++
+			scanner.Scan()
+			doc := &MetricDocument{}
+			if err := json.Unmarshal(scanner.Bytes(), doc); err != nil {
+				t.Errorf("malformed document: %s", err)
+			}
+			docs = append(docs, doc)
+			items = append(items, fmt.Sprintf(`{"index":{"_id":"%s","status":201}}`, id))
+		}
+		fmt.Fprintf(w, `{"errors":false,"items":[`)
+		for i, item := range items {
+			if i > 0 {
+				fmt.Fprintf(w, ",")
+			}
+			fmt.Fprintf(w, "%s", item)
+		}
+		fmt.Fprintf(w, `]}`)
+	}))
+	defer srv.Close()
+
+	r := newTestRunner(t, srv.URL)
+	r.Config.Outputs = []*OutputConfig{
+		{Elasticsearch: &ElasticsearchOutputConfig{Index: "metrics-test", BatchSize: 2}},
+	}
+	if err := r.ValidateConfig(); err != nil {
+		t.Fatal(err)
+	}
+	id := "28e3c0fb594443fea16131c5f26eeb81"
+	r.RunID = "test-run"
+	r.Metrics = map[string][]uint64{id: {10, 0, 30}}
+	r.MetricErrors = map[string][]error{id: {nil, fmt.Errorf("index not found"), nil}}
+
+	for i := 0; i < 2; i++ {
+		if err := r.Export(); err != nil {
+			t.Fatalf("export failed: %s", err)
+		}
+	}
+
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 distinct document IDs, received: %v", ids)
+	}
+	for k, v := range ids {
+		if v != 2 {
+			t.Fatalf("expected document %s to be sent twice, received: %d", k, v)
+		}
+	}
+	if docs[1].Value != 30 || docs[1].Period != "2020-03-03" || docs[1].RunID != "test-run" || docs[1].Category != "Helpdesk" {
+		t.Fatalf("unexpected document: %+v", docs[1])
+	}
+	if docs[1].Anomaly || docs[1].Baseline != nil || docs[1].Score != nil {
+		t.Fatalf("unexpected anomaly of the document: %+v", docs[1])
+	}
+}
+
+func TestElasticsearchOutputAnomalies(t *testing.T) {
+	r := newTestOutputRunner(t)
+	m := r.Config.Metrics[0]
+	m.Anomaly = &AnomalyConfig{Method: "zscore", Window: 3}
+	if err := m.Anomaly.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r.Config.Timestamps = dailyTimestamps(r.Config.Timestamps[0], r.Config.Timestamps[0].AddDate(0, 0, 4))
+	r.Metrics[m.ID] = []uint64{10, 12, 11, 50, 11}
+	r.MetricErrors[m.ID] = []error{nil, nil, nil, nil, nil}
+
+	docs := r.metricDocuments()
+	if len(docs) != 5 {
+		t.Fatalf("expected 5 documents, received: %d", len(docs))
+	}
+	doc := docs[3]
+	if !doc.Anomaly || doc.Baseline == nil || *doc.Baseline != 11 || doc.Score == nil || *doc.Score < 3 {
+		t.Fatalf("unexpected anomaly of the document: %+v", doc)
+	}
+	data, err := json.Marshal(docs[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "anomaly") {
+		t.Fatalf("unexpected anomaly fields of the document: %s", data)
+	}
+	if data, err = json.Marshal(doc); err != nil || !strings.Contains(string(data), `"anomaly":true,"anomaly_baseline":11,"anomaly_score":`) {
+		t.Fatalf("unexpected anomaly fields of the document: %v %s", err, data)
+	}
+}
@@ -0,0 +1,93 @@
+package esqrunner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PushgatewayOutputConfig is the configuration of the output pushing
+// metric data to Prometheus Pushgateway. The metrics are pushed in groups
+// identified by the job and the values of the grouping keys in the metric
+// metadata.
+type PushgatewayOutputConfig struct {
+	PushConfig   `yaml:",inline"`
+	Job          string   `json:"job" yaml:"job"`
+	GroupingKeys []string `json:"grouping_keys" yaml:"grouping_keys"`
+}
+
+// Validate validates PushgatewayOutputConfig.
+func (c *PushgatewayOutputConfig) Validate() error {
+	if err := c.PushConfig.validate("pushgateway"); err != nil {
+		return err
+	}
+	if c.Job == "" {
+		c.Job = "esqrunner"
+	}
+	for _, k := range c.GroupingKeys {
+		if k == "job" || prometheusName(k) != k {
+			return fmt.Errorf("pushgateway output has invalid grouping key: %s", k)
+		}
+	}
+	return nil
+}
+
+// groupingPathElement returns an element of Pushgateway URL path. The empty
+// values and the values which are not valid in the path as they are, e.g.
+// with slashes, spaces, or question marks, are base64-encoded.
+func groupingPathElement(k, v string) string {
+	if v == "" || url.PathEscape(v) != v {
+		return k + "@base64/" + base64.URLEncoding.EncodeToString([]byte(v))
+	}
+	return k + "/" + v
+}
+
+// exportPushgateway pushes the last valid value of each metric. The
+// Pushgateway rejects samples with timestamps, and holds a single sample
+// per series.
+//
+// References:
+//
+// - [Pushgateway API](https://github.com/prometheus/pushgateway#api)
+func (r *QueryRunner) exportPushgateway(cfg *PushgatewayOutputConfig) error {
+	groups := []string{}
+	groupMetrics := make(map[string][]*Metric)
+	for _, m := range r.Config.Metrics {
+		if m.Disabled {
+			continue
+		}
+		path := []string{groupingPathElement("job", cfg.Job)}
+		for _, k := range cfg.GroupingKeys {
+			path = append(path, groupingPathElement(k, m.Metadata[k]))
+		}
+		group := strings.Join(path, "/")
+		if _, exists := groupMetrics[group]; !exists {
+			groups = append(groups, group)
+		}
+		groupMetrics[group] = append(groupMetrics[group], m)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; version=0.0.4")
+	for _, group := range groups {
+		var sb strings.Builder
+		families, familyMetrics := prometheusFamilies(groupMetrics[group])
+		for _, name := range families {
+			metrics := familyMetrics[name]
+			sb.WriteString(fmt.Sprintf("# HELP %s %s\n", name, escapePrometheusHelp(metrics[0].Description)))
+			sb.WriteString(fmt.Sprintf("# TYPE %s gauge\n", name))
+			for _, m := range metrics {
+				if p := r.lastPoint(m, nil); p != nil {
+					sb.WriteString(fmt.Sprintf("%s%s %s\n", name, prometheusPointLabels(m, p), formatValue(m.prometheusValue(*p.Value))))
+				}
+			}
+		}
+		url := strings.TrimRight(cfg.URL, "/") + "/metrics/" + group
+		if err := cfg.send(http.MethodPut, url, header, []byte(sb.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package esqrunner
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// RemoteWriteOutputConfig is the configuration of the output sending
+// metric data to Prometheus remote-write endpoint.
+type RemoteWriteOutputConfig struct {
+	PushConfig `yaml:",inline"`
+}
+
+// Validate validates RemoteWriteOutputConfig.
+func (c *RemoteWriteOutputConfig) Validate() error {
+	return c.PushConfig.validate("remote_write")
+}
+
+// exportRemoteWrite sends a series per metric, with a sample per valid
+// period, as snappy-compressed protobuf WriteRequest. The samples of the
+// points flagged as anomalous are in the companion series with
+// anomaly="true" label, as the samples of Prometheus output are.
+//
+// References:
+//
+// - [Prometheus Remote-Write Specification](https://prometheus.io/docs/concepts/remote_write_spec/)
+func (r *QueryRunner) exportRemoteWrite(cfg *RemoteWriteOutputConfig) error {
+	var req []byte
+	families, familyMetrics := prometheusFamilies(r.Config.Metrics)
+	for _, name := range families {
+		for _, m := range familyMetrics[name] {
+			labels := append([][2]string{{"__name__", name}}, prometheusLabelPairs(m)...)
+			var samples, anomalies []byte
+			isNull := r.missingDataPolicy(m) == "null"
+			for _, p := range r.points(m, nil) {
+				value := math.NaN()
+				if p.Value != nil {
+					value = m.prometheusValue(*p.Value)
+				} else if !isNull {
+					continue
+				}
+				start := p.Period.Start
+				var s []byte
+				s = protoAppendFixed64(s, 1, math.Float64bits(value))
+				s = protoAppendVarint(s, 2, uint64(start.UnixNano()/int64(time.Millisecond)))
+				if p.Anomaly != nil {
+					anomalies = protoAppendBytes(anomalies, 2, s)
+				} else {
+					samples = protoAppendBytes(samples, 2, s)
+				}
+			}
+			if len(samples) > 0 {
+				req = protoAppendBytes(req, 1, append(remoteWriteLabels(labels), samples...))
+			}
+			if len(anomalies) > 0 {
+				labels = append(labels, [2]string{"anomaly", "true"})
+				req = protoAppendBytes(req, 1, append(remoteWriteLabels(labels), anomalies...))
+			}
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-protobuf")
+	header.Set("Content-Encoding", "snappy")
+	header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	return cfg.send(http.MethodPost, cfg.URL, header, snappyEncode(req))
+}
+
+// remoteWriteLabels returns the labels of a series, sorted by name.
+func remoteWriteLabels(labels [][2]string) []byte {
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+	var b []byte
+	for _, label := range labels {
+		var l []byte
+		l = protoAppendBytes(l, 1, []byte(label[0]))
+		l = protoAppendBytes(l, 2, []byte(label[1]))
+		b = protoAppendBytes(b, 1, l)
+	}
+	return b
+}
+
+func protoAppendVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func protoAppendFixed64(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|1)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func protoAppendBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// snappyEncode returns the data in snappy block format. The data is stored
+// as uncompressed literals, which every snappy decoder accepts.
+//
+// References:
+//
+// - [Snappy compressed format description](https://github.com/google/snappy/blob/main/format_description.txt)
+func snappyEncode(data []byte) []byte {
+	b := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := len(data)
+		if n > 65536 {
+			n = 65536
+		}
+		if n <= 60 {
+			b = append(b, byte(n-1)<<2)
+		} else {
+			b = append(b, 61<<2)
+			b = binary.LittleEndian.AppendUint16(b, uint16(n-1))
+		}
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	return b
+}
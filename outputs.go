@@ -0,0 +1,479 @@
+package esqrunner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// outputExtensions are the file extensions of the output formats.
+var outputExtensions = map[string]string{
+	"csv":         "csv",
+	"json":        "json",
+	"js":          "js",
+	"prometheus":  "prom",
+	"openmetrics": "txt",
+	"influx":      "lp",
+	"graphite":    "txt",
+	"ndjson":      "ndjson",
+	"xlsx":        "xlsx",
+	"html":        "html",
+	"markdown":    "md",
+	"table":       "txt",
+	"template":    "txt",
+}
+
+// outputContentTypes are the media types of the output formats.
+var outputContentTypes = map[string]string{
+	"csv":         "text/csv; charset=utf-8",
+	"json":        "application/json",
+	"js":          "application/javascript",
+	"prometheus":  "text/plain; version=0.0.4",
+	"openmetrics": "application/openmetrics-text; version=1.0.0; charset=utf-8",
+	"influx":      "text/plain; charset=utf-8",
+	"graphite":    "text/plain; charset=utf-8",
+	"ndjson":      "application/x-ndjson",
+	"xlsx":        "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"html":        "text/html; charset=utf-8",
+	"markdown":    "text/markdown; charset=utf-8",
+	"table":       "text/plain; charset=utf-8",
+	"template":    "text/plain; charset=utf-8",
+}
+
+// OutputConfig is the configuration of an output receiving metric data
+// at the end of a run. An output either sends metric data to a sink, e.g.
+// Elasticsearch or Pushgateway, or renders metric data in a format and
+// writes it to a file, the standard output, or an HTTP endpoint.
+type OutputConfig struct {
+	Elasticsearch *ElasticsearchOutputConfig `json:"elasticsearch" yaml:"elasticsearch"`
+	Pushgateway   *PushgatewayOutputConfig   `json:"pushgateway" yaml:"pushgateway"`
+	RemoteWrite   *RemoteWriteOutputConfig   `json:"remote_write" yaml:"remote_write"`
+	Influx        *InfluxOutputConfig        `json:"influx" yaml:"influx"`
+	Graphite      *GraphiteOutputConfig      `json:"graphite" yaml:"graphite"`
+	Format        string                     `json:"format" yaml:"format"`
+	Layout        string                     `json:"layout" yaml:"layout"`
+	Template      string                     `json:"template" yaml:"template"`
+	Compression   string                     `json:"compression" yaml:"compression"`
+	Path          string                     `json:"path" yaml:"path"`
+	HTTP          *HTTPOutputConfig          `json:"http" yaml:"http"`
+	Statistics    []string                   `json:"statistics" yaml:"statistics"`
+	Transforms    []*TransformConfig         `json:"transforms" yaml:"transforms"`
+	Grouping      *GroupingConfig            `json:"grouping" yaml:"grouping"`
+	Timestamps    bool                       `json:"timestamps" yaml:"timestamps"`
+	pathTemplate  *template.Template
+}
+
+// HTTPOutputConfig is the configuration of the destination sending
+// rendered metric data in the body of an HTTP request.
+type HTTPOutputConfig struct {
+	PushConfig `yaml:",inline"`
+	Method     string            `json:"method" yaml:"method"`
+	Headers    map[string]string `json:"headers" yaml:"headers"`
+}
+
+// Validate validates HTTPOutputConfig.
+func (c *HTTPOutputConfig) Validate() error {
+	if err := c.PushConfig.validate("http"); err != nil {
+		return err
+	}
+	if c.Method == "" {
+		c.Method = http.MethodPost
+	}
+	c.Method = strings.ToUpper(c.Method)
+	if c.Method != http.MethodPost && c.Method != http.MethodPut {
+		return fmt.Errorf("http output method is unsupported: %s", c.Method)
+	}
+	return nil
+}
+
+// outputPathData is the data available in output path templates.
+type outputPathData struct {
+	Prefix string
+	RunID  string
+	Date   string
+	Format string
+	Layout string
+	Ext    string
+}
+
+// Validate validates OutputConfig.
+func (o *OutputConfig) Validate(c *RunnerConfig) error {
+	sinks := 0
+	if o.Elasticsearch != nil {
+		sinks++
+		if err := o.Elasticsearch.Validate(c); err != nil {
+			return err
+		}
+	}
+	if o.Pushgateway != nil {
+		sinks++
+		if err := o.Pushgateway.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.RemoteWrite != nil {
+		sinks++
+		if err := o.RemoteWrite.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Influx != nil {
+		sinks++
+		if err := o.Influx.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Graphite != nil {
+		sinks++
+		if err := o.Graphite.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Template != "" {
+		if o.Format == "" {
+			o.Format = "template"
+		}
+		if o.Format != "template" {
+			return fmt.Errorf("output with template must have template format, found: %s", o.Format)
+		}
+		if _, err := parseOutputTemplate(o.Template); err != nil {
+			return err
+		}
+	}
+	if o.Format != "" {
+		sinks++
+		if err := o.validateRendered(); err != nil {
+			return err
+		}
+	} else if o.Layout != "" || o.Compression != "" || o.Path != "" || o.HTTP != nil || o.Statistics != nil || o.Transforms != nil || o.Grouping != nil || o.Timestamps {
+		return fmt.Errorf("output with layout, compression, path, http, statistics, transforms, grouping or timestamps must have format")
+	}
+	if sinks != 1 {
+		return fmt.Errorf("output must have exactly one sink, found: %d", sinks)
+	}
+	return nil
+}
+
+// validateRendered validates the output rendering metric data in a format.
+func (o *OutputConfig) validateRendered() error {
+	if _, exists := supportedOutputFormats[o.Format]; !exists {
+		return fmt.Errorf("the following output format is not supported: %s", o.Format)
+	}
+	if o.Format == "template" && o.Template == "" {
+		return fmt.Errorf("template output format requires template file")
+	}
+	switch o.Layout {
+	case "":
+		if o.Format == "csv" {
+			o.Layout = "portrait"
+		}
+	case "landscape", "portrait":
+		if o.Format != "csv" {
+			return fmt.Errorf("output layout is supported by csv format only, found: %s", o.Format)
+		}
+	default:
+		return fmt.Errorf("output layout is unsupported: %s", o.Layout)
+	}
+	if err := validateStatistics(o.Statistics); err != nil {
+		return err
+	}
+	if err := validateTransforms(o.Transforms, true); err != nil {
+		return err
+	}
+	if o.Grouping != nil {
+		if err := o.Grouping.Validate(); err != nil {
+			return err
+		}
+	}
+	switch o.Compression {
+	case "":
+		o.Compression = "none"
+	case "none", "gzip":
+	default:
+		return fmt.Errorf("output compression is unsupported: %s", o.Compression)
+	}
+	if o.HTTP != nil {
+		if o.Path != "" {
+			return fmt.Errorf("output must have either path or http")
+		}
+		return o.HTTP.Validate()
+	}
+	if o.Path != "" && o.Path != "-" && o.Path != "stdout" {
+		tmpl, err := template.New("path").Option("missingkey=error").Parse(o.Path)
+		if err != nil {
+			return fmt.Errorf("output path is invalid: %s", err)
+		}
+		o.pathTemplate = tmpl
+	}
+	return nil
+}
+
+// toStdout returns true when the output writes to the standard output.
+func (o *OutputConfig) toStdout() bool {
+	return o.HTTP == nil && (o.Path == "" || o.Path == "-" || o.Path == "stdout")
+}
+
+// ext returns the file extension of the output.
+func (o *OutputConfig) ext() string {
+	ext := outputExtensions[o.Format]
+	if o.Template != "" {
+		name := strings.TrimSuffix(filepath.Base(o.Template), ".tmpl")
+		if e := filepath.Ext(name); e != "" {
+			ext = e[1:]
+		}
+	}
+	if o.Compression == "gzip" {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// HasRenderedOutputs returns true when the configuration has the outputs
+// rendering metric data in a format.
+func (c *RunnerConfig) HasRenderedOutputs() bool {
+	for _, o := range c.Outputs {
+		if o.Format != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputManifest is the record of the outputs of a run.
+type OutputManifest struct {
+	RunID     string                 `json:"run_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Outputs   []*OutputManifestEntry `json:"outputs"`
+}
+
+// OutputManifestEntry is the record of an output. The size and the checksum
+// are of the data as written, i.e. after compression.
+type OutputManifestEntry struct {
+	Format      string `json:"format,omitempty"`
+	Layout      string `json:"layout,omitempty"`
+	Destination string `json:"destination"`
+	Path        string `json:"path,omitempty"`
+	Compression string `json:"compression,omitempty"`
+	Bytes       int    `json:"bytes,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+func (r *QueryRunner) addManifestEntry(entry *OutputManifestEntry) {
+	if r.Manifest == nil {
+		r.Manifest = &OutputManifest{RunID: r.RunID, Outputs: []*OutputManifestEntry{}}
+	}
+	r.Manifest.Outputs = append(r.Manifest.Outputs, entry)
+}
+
+// Export sends metric data to the outputs in the runner configuration.
+func (r *QueryRunner) Export() error {
+	return r.export(r.Config.Outputs)
+}
+
+func (r *QueryRunner) export(outputs []*OutputConfig) error {
+	for i, o := range outputs {
+		var err error
+		var destination, path string
+		switch {
+		case o.Elasticsearch != nil:
+			destination, path = "elasticsearch", o.Elasticsearch.Index
+			err = r.exportElasticsearch(o.Elasticsearch)
+		case o.Pushgateway != nil:
+			destination, path = "pushgateway", o.Pushgateway.URL
+			err = r.exportPushgateway(o.Pushgateway)
+		case o.RemoteWrite != nil:
+			destination, path = "remote_write", o.RemoteWrite.URL
+			err = r.exportRemoteWrite(o.RemoteWrite)
+		case o.Influx != nil:
+			destination, path = "influx", o.Influx.URL
+			err = r.exportInflux(o.Influx)
+		case o.Graphite != nil:
+			destination, path = "graphite", o.Graphite.Address
+			err = r.exportGraphite(o.Graphite)
+		case o.Format != "":
+			err = r.exportRendered(o)
+		}
+		if err != nil {
+			return fmt.Errorf("output %d failed: %s", i, err)
+		}
+		if destination != "" {
+			r.addManifestEntry(&OutputManifestEntry{Destination: destination, Path: path})
+		}
+	}
+	return nil
+}
+
+// exportRendered renders metric data in the format of the output, compresses
+// it, and writes it to the destination of the output.
+func (r *QueryRunner) exportRendered(o *OutputConfig) error {
+	var buf bytes.Buffer
+	opts := &renderOptions{
+		Format:     o.Format,
+		Landscape:  o.Layout == "landscape",
+		Template:   o.Template,
+		Statistics: o.Statistics,
+		Transforms: o.Transforms,
+		Grouping:   o.Grouping,
+		Timestamps: o.Timestamps || r.Config.Output.Timestamps,
+	}
+	if opts.Statistics == nil {
+		opts.Statistics = r.Config.Output.Statistics
+	}
+	if opts.Grouping == nil {
+		opts.Grouping = r.Config.Output.Grouping
+	}
+	if err := r.render(&buf, opts); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if o.Compression == "gzip" {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = zbuf.Bytes()
+	}
+	sum := sha256.Sum256(data)
+	entry := &OutputManifestEntry{
+		Format:      o.Format,
+		Layout:      o.Layout,
+		Compression: o.Compression,
+		Bytes:       len(data),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+
+	switch {
+	case o.HTTP != nil:
+		header := http.Header{}
+		header.Set("Content-Type", outputContentTypes[o.Format])
+		if o.Compression == "gzip" {
+			header.Set("Content-Encoding", "gzip")
+		}
+		for k, v := range o.HTTP.Headers {
+			header.Set(k, v)
+		}
+		if err := o.HTTP.send(o.HTTP.Method, o.HTTP.URL, header, data); err != nil {
+			return err
+		}
+		entry.Destination, entry.Path = "http", o.HTTP.URL
+	case o.toStdout():
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+		entry.Destination = "stdout"
+	default:
+		fp, err := r.outputPath(o.pathTemplate, o)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(fp, data); err != nil {
+			return err
+		}
+		log.Debugf("wrote %s output to %s", o.Format, fp)
+		entry.Destination, entry.Path = "file", fp
+	}
+	r.addManifestEntry(entry)
+	return nil
+}
+
+// outputPath returns the file path of an output. The date in the path is
+// the date of the last period of the run.
+func (r *QueryRunner) outputPath(tmpl *template.Template, o *OutputConfig) (string, error) {
+	data := &outputPathData{
+		Prefix: r.OutputPrefix,
+		RunID:  r.RunID,
+		Date:   time.Now().UTC().Format("2006-01-02"),
+		Format: o.Format,
+		Layout: o.Layout,
+		Ext:    o.ext(),
+	}
+	if n := len(r.Config.Timestamps); n > 0 {
+		data.Date = r.Config.Timestamps[n-1].Format("2006-01-02")
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed rendering output path: %s", err)
+	}
+	if strings.TrimSpace(sb.String()) == "" {
+		return "", fmt.Errorf("output path %q rendered empty", tmpl.Root.String())
+	}
+	return expandHomePath(sb.String())
+}
+
+// WriteToFiles writes metric data to the files with the provided path
+// prefix: landscape and portrait CSV, JSON and JS.
+func (r *QueryRunner) WriteToFiles(fp string) ([]string, error) {
+	r.OutputPrefix = fp
+	outputs := []*OutputConfig{
+		{Format: "csv", Layout: "landscape", Path: "{{.Prefix}}_landscape.{{.Ext}}"},
+		{Format: "csv", Layout: "portrait", Path: "{{.Prefix}}_portrait.{{.Ext}}"},
+		{Format: "json", Path: "{{.Prefix}}.{{.Ext}}"},
+		{Format: "js", Path: "{{.Prefix}}.{{.Ext}}"},
+	}
+	for _, o := range outputs {
+		if err := o.Validate(r.Config); err != nil {
+			return nil, err
+		}
+	}
+	var n int
+	if r.Manifest != nil {
+		n = len(r.Manifest.Outputs)
+	}
+	if err := r.export(outputs); err != nil {
+		return nil, err
+	}
+	outputFiles := []string{}
+	for _, entry := range r.Manifest.Outputs[n:] {
+		outputFiles = append(outputFiles, entry.Path)
+	}
+	return outputFiles, nil
+}
+
+// WriteManifest writes the manifest of the outputs of the run to the file in
+// the output configuration. The path is a template, as the paths of the
+// outputs are. When the path is empty, the manifest is not written.
+func (r *QueryRunner) WriteManifest(fp string) (string, error) {
+	if fp == "" {
+		fp = r.Config.Output.Manifest
+	}
+	if fp == "" || r.Manifest == nil {
+		return "", nil
+	}
+	tmpl, err := template.New("manifest").Option("missingkey=error").Parse(fp)
+	if err != nil {
+		return "", fmt.Errorf("manifest path is invalid: %s", err)
+	}
+	fp, err = r.outputPath(tmpl, &OutputConfig{Format: "json"})
+	if err != nil {
+		return "", err
+	}
+	r.Manifest.CreatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(r.Manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(fp, append(data, '\n')); err != nil {
+		return "", err
+	}
+	return fp, nil
+}
@@ -0,0 +1,168 @@
+package esqrunner
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var invalidPrometheusNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// prometheusName returns the provided string converted to a valid
+// Prometheus metric or label name.
+func prometheusName(s string) string {
+	s = strings.ToLower(invalidPrometheusNameChars.ReplaceAllString(s, "_"))
+	s = strings.Trim(s, "_")
+	if s == "" {
+		return "_"
+	}
+	if s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	return s
+}
+
+func escapePrometheusLabelValue(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+func escapePrometheusHelp(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+// prometheusLabelPairs returns the labels of a metric: category, metric ID
+// and metadata. The metadata keys clashing with the former, or with the
+// anomaly label of the metrics with anomaly detection, are skipped.
+func prometheusLabelPairs(m *Metric) [][2]string {
+	labels := [][2]string{
+		{"category", m.Category},
+		{"metric_id", m.ID},
+	}
+	seen := map[string]bool{"category": true, "metric_id": true, "anomaly": m.Anomaly != nil}
+	keys := []string{}
+	for k := range m.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := prometheusName(k)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		labels = append(labels, [2]string{name, m.Metadata[k]})
+	}
+	return labels
+}
+
+func prometheusLabels(m *Metric) string {
+	labels := []string{}
+	for _, pair := range prometheusLabelPairs(m) {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pair[0], escapePrometheusLabelValue(pair[1])))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// prometheusPointLabels returns the labels of the sample of a point, with
+// anomaly="true" label when the point is flagged as anomalous.
+func prometheusPointLabels(m *Metric, p *MetricPoint) string {
+	labels := prometheusLabels(m)
+	if p.Anomaly == nil {
+		return labels
+	}
+	return strings.TrimSuffix(labels, "}") + `,anomaly="true"}`
+}
+
+// prometheusFamilies groups enabled metrics by their Prometheus names,
+// in the order of their first appearance. The names of the metrics with
+// units end with the base units, e.g. _bytes or _seconds.
+func prometheusFamilies(metrics []*Metric) ([]string, map[string][]*Metric) {
+	families := []string{}
+	familyMetrics := make(map[string][]*Metric)
+	for _, m := range metrics {
+		if m.Disabled {
+			continue
+		}
+		name := "esqrunner_" + prometheusName(m.Name)
+		if unit := m.prometheusUnit(); unit != "" && !strings.HasSuffix(name, "_"+unit) {
+			name += "_" + unit
+		}
+		if _, exists := familyMetrics[name]; !exists {
+			families = append(families, name)
+		}
+		familyMetrics[name] = append(familyMetrics[name], m)
+	}
+	return families, familyMetrics
+}
+
+// outputPrometheus writes metric data in Prometheus text exposition format,
+// or in OpenMetrics format. By default, the samples have no timestamps, as
+// node_exporter textfile collector requires, and each metric has a single
+// sample, the last valid value. With timestamps, each period of a metric
+// has a sample with the timestamp of the period. The samples of the points
+// flagged as anomalous have anomaly="true" label. The values are in the
+// base units, e.g. milliseconds are converted to seconds, and the
+// OpenMetrics families of the metrics with units have the units.
+//
+// References:
+//
+// - [Exposition formats](https://prometheus.io/docs/instrumenting/exposition_formats/)
+//
+// - [OpenMetrics](https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md)
+func (r *QueryRunner) outputPrometheus(sb *strings.Builder, opts *renderOptions) {
+	openMetrics := opts.Format == "openmetrics"
+	families, familyMetrics := prometheusFamilies(r.Config.Metrics)
+	for _, name := range families {
+		metrics := familyMetrics[name]
+		sb.WriteString(fmt.Sprintf("# HELP %s %s\n", name, escapePrometheusHelp(metrics[0].Description)))
+		sb.WriteString(fmt.Sprintf("# TYPE %s gauge\n", name))
+		if unit := prometheusFamilyUnit(metrics); openMetrics && unit != "" {
+			sb.WriteString(fmt.Sprintf("# UNIT %s %s\n", name, unit))
+		}
+		for _, m := range metrics {
+			labels := prometheusLabels(m)
+			if !opts.Timestamps {
+				if p := r.lastPoint(m, opts.Transforms); p != nil {
+					sb.WriteString(fmt.Sprintf("%s%s %s\n", name, prometheusPointLabels(m, p), formatValue(m.prometheusValue(*p.Value))))
+				} else if r.missingDataPolicy(m) == "null" {
+					sb.WriteString(fmt.Sprintf("%s%s NaN\n", name, labels))
+				}
+				continue
+			}
+			isNull := r.missingDataPolicy(m) == "null"
+			for _, p := range r.points(m, opts.Transforms) {
+				value := "NaN"
+				if p.Value != nil {
+					value = formatValue(m.prometheusValue(*p.Value))
+				} else if !isNull {
+					continue
+				}
+				start := p.Period.Start
+				if openMetrics {
+					sb.WriteString(fmt.Sprintf("%s%s %s %d\n", name, prometheusPointLabels(m, p), value, start.Unix()))
+				} else {
+					sb.WriteString(fmt.Sprintf("%s%s %s %d\n", name, prometheusPointLabels(m, p), value, start.UnixNano()/int64(time.Millisecond)))
+				}
+			}
+		}
+	}
+	if openMetrics {
+		sb.WriteString("# EOF\n")
+	}
+}
+
+// prometheusFamilyUnit returns the base unit of the metrics of a family, or
+// an empty string when the metrics have no units.
+func prometheusFamilyUnit(metrics []*Metric) string {
+	for _, m := range metrics {
+		if unit := m.prometheusUnit(); unit != "" {
+			return unit
+		}
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package esqrunner
+
+import (
+	"bytes"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// PushConfig is the common configuration of the outputs pushing metric
+// data over HTTP.
+type PushConfig struct {
+	URL          string `json:"url" yaml:"url"`
+	Username     string `json:"username" yaml:"username"`
+	Password     string `json:"password" yaml:"password"`
+	Retries      int    `json:"retries" yaml:"retries"`
+	RetryBackoff string `json:"retry_backoff" yaml:"retry_backoff"`
+	Timeout      string `json:"timeout" yaml:"timeout"`
+	retryBackoff time.Duration
+	timeout      time.Duration
+}
+
+func (c *PushConfig) validate(name string) error {
+	if c.URL == "" {
+		return fmt.Errorf("%s output has no url", name)
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("%s output has negative retries", name)
+	}
+	if c.RetryBackoff == "" {
+		c.RetryBackoff = "1s"
+	}
+	if c.Timeout == "" {
+		c.Timeout = "10s"
+	}
+	var err error
+	if c.retryBackoff, err = time.ParseDuration(c.RetryBackoff); err != nil {
+		return fmt.Errorf("%s output has invalid retry backoff: %s", name, err)
+	}
+	if c.timeout, err = time.ParseDuration(c.Timeout); err != nil {
+		return fmt.Errorf("%s output has invalid timeout: %s", name, err)
+	}
+	return nil
+}
+
+// send sends the request and retries it on connection errors, and when the
+// receiver responds with 429 or 5xx status codes. The backoff doubles
+// after each attempt.
+func (c *PushConfig) send(method, url string, header http.Header, body []byte) error {
+	client := &http.Client{Timeout: c.timeout}
+	backoff := c.retryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			log.Debugf("retrying %s %s in %s, attempt %d: %s", method, url, backoff, attempt, lastErr)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if c.Username != "" || c.Password != "" {
+			req.SetBasicAuth(c.Username, c.Password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("%s %s responded with %d: %s", method, url, resp.StatusCode, bytes.TrimSpace(respBody))
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// lastPoint returns the point of the last period with a value, either
+// collected or filled, with the transforms of the output, or nil when no
+// period has a value.
+func (r *QueryRunner) lastPoint(m *Metric, output []*TransformConfig) *MetricPoint {
+	points := r.points(m, output)
+	for i := len(points) - 1; i >= 0; i-- {
+		if points[i].Value != nil {
+			return points[i]
+		}
+	}
+	return nil
+}
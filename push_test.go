@@ -0,0 +1,313 @@
+package esqrunner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPushgatewayOutput(t *testing.T) {
+	attempts := 0
+	bodies := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if user, pass, ok := req.BasicAuth(); !ok || user != "esq" || pass != "secret" {
+			t.Errorf("unexpected credentials: %s %s", user, pass)
+		}
+		if req.Method != http.MethodPut {
+			t.Errorf("unexpected method: %s", req.Method)
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies[req.URL.Path] = string(body)
+	}))
+	defer srv.Close()
+
+	r := newTestOutputRunner(t)
+	cfg := &PushgatewayOutputConfig{
+		PushConfig:   PushConfig{URL: srv.URL, Username: "esq", Password: "secret", Retries: 2, RetryBackoff: "1ms"},
+		GroupingKeys: []string{"team"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.exportPushgateway(cfg); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, received: %d", attempts)
+	}
+	body, exists := bodies["/metrics/job/esqrunner/team@base64/U2VydmljZSAiRGVzayI="]
+	if !exists {
+		t.Fatalf("expected grouping key in path, received: %v", bodies)
+	}
+	expected := `esqrunner_helpdesk_ticket_total{category="Helpdesk",metric_id="28e3c0fb594443fea16131c5f26eeb81",team="Service \"Desk\"",tier_level="1"} 30` + "\n"
+	if !strings.HasSuffix(body, expected) {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+}
+
+func TestGroupingPathElement(t *testing.T) {
+	testcases := map[string]string{
+		"helpdesk":   "team/helpdesk",
+		"":           "team@base64/",
+		"a/b":        "team@base64/YS9i",
+		"a b":        "team@base64/YSBi",
+		"a?b#c":      "team@base64/YT9iI2M=",
+		"100%":       "team@base64/MTAwJQ==",
+		"tier-1_ops": "team/tier-1_ops",
+	}
+	for v, expected := range testcases {
+		if s := groupingPathElement("team", v); s != expected {
+			t.Fatalf("unexpected path element of %q: %s, expected: %s", v, s, expected)
+		}
+	}
+}
+
+func TestRemoteWriteOutput(t *testing.T) {
+	var series [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("unexpected content encoding: %s", req.Header.Get("Content-Encoding"))
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		data, err := testSnappyDecode(body)
+		if err != nil {
+			t.Errorf("snappy decoding failed: %s", err)
+		}
+		for _, f := range testProtoFields(t, data) {
+			if f.num == 1 {
+				series = append(series, f.data)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	r := newTestOutputRunner(t)
+	cfg := &RemoteWriteOutputConfig{PushConfig{URL: srv.URL}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.exportRemoteWrite(cfg); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	if len(series) != 1 {
+		t.Fatalf("expected 1 series, received: %d", len(series))
+	}
+	labels := []string{}
+	values := []float64{}
+	for _, f := range testProtoFields(t, series[0]) {
+		inner := testProtoFields(t, f.data)
+		switch f.num {
+		case 1:
+			labels = append(labels, fmt.Sprintf("%s=%s", inner[0].data, inner[1].data))
+		case 2:
+			values = append(values, math.Float64frombits(inner[0].value))
+		}
+	}
+	if labels[0] != "__name__=esqrunner_helpdesk_ticket_total" || len(labels) != 5 {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+	if len(values) != 2 || values[0] != 10 || values[1] != 30 {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	// The samples of the anomalous points are in the companion series.
+	m := r.Config.Metrics[0]
+	m.Anomaly = &AnomalyConfig{Method: "zscore", Window: 3}
+	if err := m.Anomaly.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r.Config.Timestamps = dailyTimestamps(r.Config.Timestamps[0], r.Config.Timestamps[0].AddDate(0, 0, 4))
+	r.Metrics[m.ID] = []uint64{10, 12, 11, 50, 11}
+	r.MetricErrors[m.ID] = []error{nil, nil, nil, nil, nil}
+	series = nil
+	if err := r.exportRemoteWrite(cfg); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("expected 2 series, received: %d", len(series))
+	}
+	labels, values = []string{}, []float64{}
+	for _, f := range testProtoFields(t, series[1]) {
+		inner := testProtoFields(t, f.data)
+		switch f.num {
+		case 1:
+			labels = append(labels, fmt.Sprintf("%s=%s", inner[0].data, inner[1].data))
+		case 2:
+			values = append(values, math.Float64frombits(inner[0].value))
+		}
+	}
+	if labels[0] != "__name__=esqrunner_helpdesk_ticket_total" || labels[1] != "anomaly=true" || len(labels) != 6 {
+		t.Fatalf("unexpected labels of the anomalies: %v", labels)
+	}
+	if len(values) != 1 || values[0] != 50 {
+		t.Fatalf("unexpected values of the anomalies: %v", values)
+	}
+}
+
+func TestInfluxOutput(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v2/write" || req.URL.Query().Get("bucket") != "metrics" || req.URL.Query().Get("precision") != "ns" {
+			t.Errorf("unexpected request: %s", req.URL)
+		}
+		if req.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("unexpected authorization: %s", req.Header.Get("Authorization"))
+		}
+		data, _ := ioutil.ReadAll(req.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	r := newTestOutputRunner(t)
+	cfg := &InfluxOutputConfig{PushConfig: PushConfig{URL: srv.URL}, Org: "esq", Bucket: "metrics", Token: "secret"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.exportInflux(cfg); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	prefix := `Helpdesk\ Ticket\ Total,category=Helpdesk,metric_id=28e3c0fb594443fea16131c5f26eeb81,team=Service\ "Desk",tier-level=1 value=`
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], prefix+"10 ") || !strings.HasPrefix(lines[1], prefix+"30 ") {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+	ts := r.Config.Timestamps[0].UnixNano()
+	if !strings.HasSuffix(lines[0], fmt.Sprintf(" %d", ts)) {
+		t.Fatalf("expected nanosecond timestamp %d, received: %s", ts, lines[0])
+	}
+
+	r.Config.Metrics[0].MissingData = "interpolate"
+	r.Config.Metrics[0].Scale = 0.25
+	var sb strings.Builder
+	r.outputInflux(&sb, nil)
+	lines = strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], prefix+"2.5 ") || !strings.HasPrefix(lines[1], prefix+"5 ") || !strings.HasPrefix(lines[2], prefix+"7.5 ") {
+		t.Fatalf("unexpected fractional values:\n%s", sb.String())
+	}
+}
+
+func TestGraphiteOutput(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		data, _ := ioutil.ReadAll(conn)
+		conn.Close()
+		received <- string(data)
+	}()
+
+	r := newTestOutputRunner(t)
+	cfg := &GraphiteOutputConfig{Address: ln.Addr().String()}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.exportGraphite(cfg); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	body := <-received
+	expected := fmt.Sprintf(
+		"esqrunner.helpdesk.helpdesk_ticket_total 10 %d\nesqrunner.helpdesk.helpdesk_ticket_total 30 %d\n",
+		r.Config.Timestamps[0].Unix(), r.Config.Timestamps[2].Unix(),
+	)
+	if body != expected {
+		t.Fatalf("unexpected body:\n%s\nexpected:\n%s", body, expected)
+	}
+}
+
+type testProtoField struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+func testProtoFields(t *testing.T, b []byte) []testProtoField {
+	fields := []testProtoField{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		f := testProtoField{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case 1:
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			b = b[n:]
+			f.data = b[:size]
+			b = b[size:]
+		default:
+			t.Fatalf("unexpected wire type: %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func testSnappyDecode(b []byte) ([]byte, error) {
+	size, n := binary.Uvarint(b)
+	b = b[n:]
+	out := []byte{}
+	for len(b) > 0 {
+		tag := b[0]
+		b = b[1:]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			length = int(tag >> 2)
+			if length >= 60 {
+				extra := length - 59
+				length = 0
+				for i := 0; i < extra; i++ {
+					length |= int(b[i]) << (8 * i)
+				}
+				b = b[extra:]
+			}
+			length++
+			out = append(out, b[:length]...)
+			b = b[length:]
+			continue
+		case 1:
+			length = int(tag>>2&7) + 4
+			offset = int(tag>>5)<<8 | int(b[0])
+			b = b[1:]
+		case 2:
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint16(b))
+			b = b[2:]
+		case 3:
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		}
+		for i := 0; i < length; i++ {
+			out = append(out, out[len(out)-offset])
+		}
+	}
+	if uint64(len(out)) != size {
+		return nil, fmt.Errorf("decoded %d bytes, expected %d", len(out), size)
+	}
+	return out, nil
+}
@@ -0,0 +1,285 @@
+package esqrunner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/greenpau/go-calculator"
+	"time"
+)
+
+// ReportSchemaVersion is the version of the structure of Report. It changes
+// when the fields are renamed or removed.
+const ReportSchemaVersion = "2.0"
+
+// Report is the typed representation of the results of a run.
+type Report struct {
+	Schema            string             `json:"schema"`
+	Run               *ReportRun         `json:"run"`
+	MetricDefinitions []*Metric          `json:"metric_definitions"`
+	Timestamps        []int64            `json:"timestamps"`
+	Periods           []*ReportPeriod    `json:"periods"`
+	Comparison        *ReportComparison  `json:"comparison,omitempty"`
+	Transforms        []*TransformConfig `json:"transforms,omitempty"`
+	Metrics           []*MetricResult    `json:"metrics"`
+	Evaluation        *ReportEvaluation  `json:"evaluation,omitempty"`
+}
+
+// ReportRun holds the metadata of a run.
+type ReportRun struct {
+	ID             string     `json:"id"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	ClusterName    string     `json:"cluster_name,omitempty"`
+	ClusterVersion string     `json:"cluster_version,omitempty"`
+	ConfigHash     string     `json:"config_hash"`
+}
+
+// ReportPeriod is the time range covered by a data point.
+type ReportPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// rollup is the calendar unit of the rolled up periods, which may be
+	// partial at the edges of a run.
+	rollup string
+}
+
+// MetricResult holds the data points and the summary of a metric. The unit
+// describes the values, which are scaled already.
+type MetricResult struct {
+	ID       string             `json:"id"`
+	Category string             `json:"category"`
+	Name     string             `json:"name"`
+	Metadata map[string]string  `json:"metadata,omitempty"`
+	Unit     *MetricUnit        `json:"unit,omitempty"`
+	Points   []*MetricPoint     `json:"points"`
+	Summary  *MetricSummary     `json:"summary"`
+	Compare  *SummaryComparison `json:"compare,omitempty"`
+	Forecast *MetricForecast    `json:"forecast,omitempty"`
+	SLO      *SLOStatus         `json:"slo,omitempty"`
+	metric   *Metric
+	subtotal bool
+}
+
+// MetricPoint is the value of a metric for a period. When the value
+// could not be collected, the error is set, and the value is either nil or
+// filled according to the missing data policy.
+type MetricPoint struct {
+	Period  *ReportPeriod    `json:"period"`
+	Value   *float64         `json:"value"`
+	Filled  bool             `json:"filled,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	Compare *PointComparison `json:"compare,omitempty"`
+	Anomaly *PointAnomaly    `json:"anomaly,omitempty"`
+
+	// days is the number of daily values the value of a rolled up point
+	// accumulates, i.e. the days the rate of the point is over.
+	days int
+}
+
+// MetricSummary holds the summary statistics of a metric. The statistics
+// are computed over the points with collected values, and the points
+// without values or with filled values are counted as excluded. The points
+// which could not be collected are counted as missing, and the ones filled
+// according to the missing data policy as filled. The variance and the standard
+// deviation are of the population. The change is between the first and
+// the last values.
+type MetricSummary struct {
+	Total     float64   `json:"total"`
+	Max       float64   `json:"max"`
+	Min       float64   `json:"min"`
+	Mean      float64   `json:"mean"`
+	Median    float64   `json:"median"`
+	Modes     []float64 `json:"modes"`
+	Range     float64   `json:"range"`
+	StdDev    float64   `json:"stddev"`
+	Variance  float64   `json:"variance"`
+	P50       float64   `json:"p50"`
+	P90       float64   `json:"p90"`
+	P95       float64   `json:"p95"`
+	P99       float64   `json:"p99"`
+	CV        *float64  `json:"cv"`
+	Valid     int       `json:"valid"`
+	Missing   int       `json:"missing"`
+	Excluded  int       `json:"excluded"`
+	Filled    int       `json:"filled"`
+	First     *float64  `json:"first"`
+	Last      *float64  `json:"last"`
+	Change    *float64  `json:"change"`
+	ChangePct *float64  `json:"change_pct"`
+}
+
+// Metric returns the definition of the metric.
+func (m *MetricResult) Metric() *Metric {
+	return m.metric
+}
+
+// Subtotal returns true when the result is the subtotal of a category.
+func (m *MetricResult) Subtotal() bool {
+	return m.subtotal
+}
+
+// Hash returns the hash of the fields of the configuration defining the
+// results of a run in the cluster: the metric definitions, the dates, the
+// comparison, the missing data policy and the transformations. The outputs,
+// the endpoints and the credentials are left out, so that the reports made
+// with the same hash are comparable.
+func (c *RunnerConfig) Hash(cluster string) string {
+	h := sha256.New()
+	data, _ := json.Marshal(struct {
+		Cluster           string             `json:"cluster"`
+		Metrics           []*Metric          `json:"metrics"`
+		Timestamps        []time.Time        `json:"timestamps"`
+		Compare           string             `json:"compare"`
+		CompareTimestamps []time.Time        `json:"compare_timestamps"`
+		MissingData       string             `json:"missing_data"`
+		Transforms        []*TransformConfig `json:"transforms"`
+	}{
+		Cluster:           cluster,
+		Metrics:           c.Metrics,
+		Timestamps:        c.Timestamps,
+		Compare:           c.Compare,
+		CompareTimestamps: c.CompareTimestamps,
+		MissingData:       c.MissingData,
+		Transforms:        c.Transforms,
+	})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// periodOf returns the daily period starting on the day of the timestamp.
+func periodOf(ts time.Time) *ReportPeriod {
+	start := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+	return &ReportPeriod{Start: start, End: start.AddDate(0, 0, 1)}
+}
+
+// summarize returns the summary statistics of the data points.
+func summarize(points []*MetricPoint) *MetricSummary {
+	values, excluded := validValues(points)
+	summary := &MetricSummary{
+		Modes:    []float64{},
+		Valid:    len(values),
+		Excluded: excluded,
+	}
+	if len(values) == 0 {
+		extendStatistics(summary, points, values)
+		return summary
+	}
+	calc := calculator.New(values)
+	calc.RunAll()
+	summary.Total = calc.Register.Total
+	summary.Max = calc.Register.MaxValue
+	summary.Min = calc.Register.MinValue
+	summary.Mean = calc.Register.Mean
+	summary.Median = calc.Register.Median
+	summary.Range = calc.Register.Range
+	summary.Variance = calc.Register.Variance
+	summary.StdDev = calc.Register.StandardDeviation
+	if calc.Register.Modes != nil {
+		summary.Modes = calc.Register.Modes
+	}
+	extendStatistics(summary, points, values)
+	return summary
+}
+
+// Report returns the results of a run.
+func (r *QueryRunner) Report() *Report {
+	return r.report(nil)
+}
+
+// report returns the results of a run with the transformations of the
+// output being rendered, if any.
+func (r *QueryRunner) report(output []*TransformConfig) *Report {
+	report := &Report{
+		Schema: ReportSchemaVersion,
+		Run: &ReportRun{
+			ID:             r.RunID,
+			ClusterName:    r.clusterName,
+			ClusterVersion: r.clusterVersion,
+			ConfigHash:     r.Config.Hash(r.cluster),
+		},
+		MetricDefinitions: r.Config.Metrics,
+		Timestamps:        []int64{},
+		Periods:           []*ReportPeriod{},
+		Metrics:           []*MetricResult{},
+	}
+	if !r.StartedAt.IsZero() {
+		report.Run.StartedAt = &r.StartedAt
+	}
+	if !r.FinishedAt.IsZero() {
+		report.Run.FinishedAt = &r.FinishedAt
+	}
+	if report.MetricDefinitions == nil {
+		report.MetricDefinitions = []*Metric{}
+	}
+	report.Periods = r.periods(r.Config.Timestamps, output)
+	for i, p := range report.Periods {
+		ts := p.Start
+		if len(report.Periods) == len(r.Config.Timestamps) {
+			ts = r.Config.Timestamps[i]
+		}
+		report.Timestamps = append(report.Timestamps, ts.Unix()*1000)
+	}
+	if transforms := r.transformsOf(nil, output); len(transforms) > 0 {
+		report.Transforms = transforms
+	}
+	if r.hasComparison() {
+		report.Comparison = &ReportComparison{
+			Mode:    r.Config.Compare,
+			Periods: r.periods(r.Config.CompareTimestamps, output),
+		}
+	}
+	for _, m := range r.Config.Metrics {
+		if m.Disabled {
+			continue
+		}
+		points := r.points(m, output)
+		for i, p := range points {
+			if i < len(report.Periods) {
+				p.Period = report.Periods[i]
+			}
+		}
+		result := &MetricResult{
+			ID:       m.ID,
+			Category: m.Category,
+			Name:     m.Name,
+			Metadata: m.Metadata,
+			Unit:     m.unit(),
+			Points:   points,
+			Summary:  summarize(points),
+			Forecast: forecast(points, m.Forecast),
+			SLO:      r.sloStatus(m),
+			metric:   m,
+		}
+		if r.hasComparison() {
+			r.compareResult(result, output)
+		}
+		report.Metrics = append(report.Metrics, result)
+	}
+	report.Evaluation = evaluate(report)
+	return report
+}
+
+// ReportCategory holds the results of the metrics of a category.
+type ReportCategory struct {
+	Name    string
+	Metrics []*MetricResult
+}
+
+// Categories returns the results grouped by metric category, in the order
+// of their first appearance.
+func (r *Report) Categories() []*ReportCategory {
+	categories := []*ReportCategory{}
+	index := make(map[string]*ReportCategory)
+	for _, m := range r.Metrics {
+		c, exists := index[m.Category]
+		if !exists {
+			c = &ReportCategory{Name: m.Category}
+			index[m.Category] = c
+			categories = append(categories, c)
+		}
+		c.Metrics = append(c.Metrics, m)
+	}
+	return categories
+}
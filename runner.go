@@ -3,22 +3,65 @@ package esqrunner
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/greenpau/go-calculator"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // QueryRunner is Elasticsearch query runner.
 type QueryRunner struct {
-	client       *ElasticsearchClient
-	Config       *RunnerConfig
-	Metrics      map[string][]uint64
-	MetricErrors map[string][]error
-	ValidateOnly bool
+	client         *ElasticsearchClient
+	Config         *RunnerConfig
+	Metrics        map[string][]uint64
+	MetricErrors   map[string][]error
+	CompareMetrics map[string][]uint64
+	CompareErrors  map[string][]error
+	ValidateOnly   bool
+	RunID          string
+	StartedAt      time.Time
+	FinishedAt     time.Time
+	Stream         *NDJSONWriter
+	OutputPrefix   string
+	Manifest       *OutputManifest
+	Summary        *RunSummary
+	cache          *ResultCache
+	history        *HistoryStore
+	cluster        string
+	clusterName    string
+	clusterVersion string
+	validated      bool
+}
+
+// RunSummary holds the statistics of a run.
+type RunSummary struct {
+	Queries     int
+	Errors      int
+	CacheHits   int
+	CacheMisses int
+	HistoryHits int
+}
+
+// CacheHitRate returns the percentage of cacheable results served
+// from the cache.
+func (s *RunSummary) CacheHitRate() float64 {
+	total := s.CacheHits + s.CacheMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.CacheHits) * 100 / float64(total)
+}
+
+// String returns the summary of a run.
+func (s *RunSummary) String() string {
+	return fmt.Sprintf(
+		"queries: %d, errors: %d, history hits: %d, cache hits: %d, cache misses: %d, cache hit rate: %.2f%%",
+		s.Queries, s.Errors, s.HistoryHits, s.CacheHits, s.CacheMisses, s.CacheHitRate(),
+	)
 }
 
 // New return an instance of QueryRunner.
@@ -54,6 +97,7 @@ func (r *QueryRunner) ReadInConfig(configFile string) error {
 		return err
 	}
 	r.Config = &config
+	r.validated = false
 	return nil
 }
 
@@ -62,250 +106,361 @@ func (r *QueryRunner) ValidateConfig() error {
 	if r.Config == nil {
 		return fmt.Errorf("configuration not found")
 	}
+	if r.validated {
+		return nil
+	}
 	if err := r.Config.Validate(); err != nil {
 		return err
 	}
+	r.validated = true
 	return nil
 }
 
 // Run triggers the execution of the queries.
 func (r *QueryRunner) Run() error {
+	if err := r.connect(); err != nil {
+		return err
+	}
+	defer r.disconnect()
+	r.warnPartialWindows()
+	r.collect(r.Config.Timestamps)
+	if len(r.Config.CompareTimestamps) > 0 {
+		r.collectComparison()
+	}
+	r.FinishedAt = time.Now().UTC()
+	log.Infof("run summary: %s", r.Summary)
+	return nil
+}
+
+// Backfill records the values of the metrics for the days between two dates
+// in the history. The days are queried in chunks, and the days already
+// present in the history are skipped, so that an interrupted backfill
+// resumes where it stopped.
+func (r *QueryRunner) Backfill(from, to time.Time, chunkSize int) error {
+	if err := r.ValidateConfig(); err != nil {
+		return err
+	}
+	if r.Config.History == nil {
+		return fmt.Errorf("backfill requires history configuration")
+	}
+	if chunkSize < 1 {
+		return fmt.Errorf("backfill chunk size must be positive")
+	}
+	if to.Before(from) {
+		return fmt.Errorf("backfill range ends before it starts")
+	}
+	if err := r.connect(); err != nil {
+		return err
+	}
+	defer r.disconnect()
+	// The values of the chunks are appended in the order of the days, so
+	// that they stay aligned with the timestamps of the backfill.
+	timestamps := dailyTimestamps(from, to)
+	r.Metrics = nil
+	r.MetricErrors = nil
+	for i := 0; i < len(timestamps); i += chunkSize {
+		j := i + chunkSize
+		if j > len(timestamps) {
+			j = len(timestamps)
+		}
+		chunk := timestamps[i:j]
+		r.collect(chunk)
+		log.Infof(
+			"backfilled %s to %s, %s",
+			chunk[0].Format("2006-01-02"), chunk[len(chunk)-1].Format("2006-01-02"), r.Summary,
+		)
+	}
+	r.Config.Timestamps = timestamps
+	return nil
+}
+
+// connect validates configuration, connects to Elasticsearch and opens
+// cache and history stores. When the history is read-only, Elasticsearch
+// is not queried.
+func (r *QueryRunner) connect() error {
 	if err := r.ValidateConfig(); err != nil {
 		return err
 	}
 
-	if r.Metrics == nil {
-		r.Metrics = make(map[string][]uint64)
+	r.Summary = &RunSummary{}
+	r.StartedAt = time.Now().UTC()
+	if r.RunID == "" {
+		r.RunID = newRunID()
 	}
 
-	if r.MetricErrors == nil {
-		r.MetricErrors = make(map[string][]error)
+	if r.Config.History != nil {
+		history, err := OpenHistoryStore(r.Config.History.Dir)
+		if err != nil {
+			return err
+		}
+		r.history = history
+		if r.Config.History.ReadOnly {
+			return nil
+		}
 	}
 
 	client, err := NewElasticsearchClient(r.Config.Elasticsearch)
 	if err != nil {
+		r.disconnect()
 		return err
 	}
 
 	r.client = client
 	srv, err := r.client.Info()
 	if err != nil {
+		r.disconnect()
 		return err
 	}
 	log.Debugf("Elasticsearch server version: %s", srv.Version)
 
-	for _, ts := range r.Config.Timestamps {
-		log.Debugf("Processing date: %s", ts)
-		for _, m := range r.Config.Metrics {
-			if m.Disabled {
-				continue
-			}
-			if m.IndexSplit != "daily" {
-				continue
-			}
-			if _, exists := r.Metrics[m.ID]; !exists {
-				r.Metrics[m.ID] = []uint64{}
-			}
-			if _, exists := r.MetricErrors[m.ID]; !exists {
-				r.MetricErrors[m.ID] = []error{}
-			}
-			suffix := fmt.Sprintf("%d%02d%02d", ts.Year(), ts.Month(), ts.Day())
-			count, err := r.client.Count(m, suffix)
-			if err != nil {
-				r.Metrics[m.ID] = append(r.Metrics[m.ID], 0)
-				r.MetricErrors[m.ID] = append(r.MetricErrors[m.ID], err)
-				continue
-			}
-			r.Metrics[m.ID] = append(r.Metrics[m.ID], count.Total)
-			r.MetricErrors[m.ID] = append(r.MetricErrors[m.ID], nil)
+	r.clusterName = srv.ClusterName
+	r.clusterVersion = srv.Version
+	r.cluster = srv.ClusterUUID
+	if r.cluster == "" {
+		r.cluster = strings.Join(r.Config.Elasticsearch.Address, ",")
+	}
+
+	if r.Config.Cache != nil && !r.Config.Cache.Disabled {
+		cache, err := OpenResultCache(r.Config.Cache.Dir)
+		if err != nil {
+			r.disconnect()
+			return err
 		}
+		r.cache = cache
 	}
 	return nil
 }
 
-// Output returns metrics data.
-func (r *QueryRunner) Output() (string, error) {
-	var sb strings.Builder
-	if r.Config.Output.Format == "csv" {
-		sp := ";"
-		if r.Config.Output.Landscape {
-			line := []string{}
-			line = append(line, "Categories")
-			line = append(line, "Metrics")
-			for _, k := range r.Config.Metadata.FieldList {
-				line = append(line, strings.Title(k))
-			}
-			for _, ts := range r.Config.Timestamps {
-				line = append(line, ts.Format("2006/01/02"))
-			}
-			line = append(line, "Total")
-			line = append(line, "Max")
-			line = append(line, "Min")
-			line = append(line, "Average")
-			line = append(line, "Median")
-			line = append(line, "Modes")
-			line = append(line, "Range")
-			line = append(line, "Metric ID")
-			sb.WriteString(strings.Join(line, sp) + "\n")
+// disconnect saves the cache and closes the history.
+func (r *QueryRunner) disconnect() {
+	if r.cache != nil {
+		if err := r.cache.Close(); err != nil {
+			log.Warnf("failed saving cache: %s", err)
+		}
+		r.cache = nil
+	}
+	if r.history != nil {
+		if err := r.history.Close(); err != nil {
+			log.Warnf("failed closing history: %s", err)
+		}
+		r.history = nil
+	}
+}
 
-			for _, m := range r.Config.Metrics {
-				if m.Disabled {
-					continue
-				}
-				line = []string{}
-				line = append(line, m.Category)
-				line = append(line, m.Name)
+// collect gets the values of the metrics for the provided timestamps.
+func (r *QueryRunner) collect(timestamps []time.Time) {
+	if r.Metrics == nil {
+		r.Metrics = make(map[string][]uint64)
+	}
 
-				for _, k := range r.Config.Metadata.FieldList {
-					if v, exists := m.Metadata[k]; exists {
-						line = append(line, fmt.Sprintf("%s", v))
-					} else {
-						line = append(line, "-")
-					}
-				}
+	if r.MetricErrors == nil {
+		r.MetricErrors = make(map[string][]error)
+	}
 
-				for i, count := range r.Metrics[m.ID] {
-					if r.MetricErrors[m.ID][i] == nil {
-						line = append(line, fmt.Sprintf("%d", count))
-					} else {
-						line = append(line, "-")
-					}
-				}
-				calc := calculator.NewUint64(r.Metrics[m.ID])
-				calc.RunAll()
-				line = append(line, fmt.Sprintf("%.2f", calc.Register.Total))
-				line = append(line, fmt.Sprintf("%.2f", calc.Register.MaxValue))
-				line = append(line, fmt.Sprintf("%.2f", calc.Register.MinValue))
-				line = append(line, fmt.Sprintf("%.2f", calc.Register.Mean))
-				line = append(line, fmt.Sprintf("%.2f", calc.Register.Median))
-				line = append(line, fmt.Sprintf("%v", calc.Register.Modes))
-				line = append(line, fmt.Sprintf("%.2f", calc.Register.Range))
-				line = append(line, m.ID)
-				sb.WriteString(strings.Join(line, sp) + "\n")
-			}
-		} else {
-			line := []string{}
-			line = append(line, "Date")
-			line = append(line, "Value")
-			line = append(line, "Category")
-			line = append(line, "Metric Name")
-			for _, k := range r.Config.Metadata.FieldList {
-				line = append(line, strings.Title(k))
+	streamed := map[string]int{}
+	for i, ts := range timestamps {
+		log.Debugf("Processing date: %s", ts)
+		for _, metric := range r.Config.Metrics {
+			if metric.Disabled {
+				continue
 			}
-
-			line = append(line, "Metric ID")
-			sb.WriteString(strings.Join(line, sp) + "\n")
-			for _, m := range r.Config.Metrics {
-				if m.Disabled {
-					continue
-				}
-				for i, ts := range r.Config.Timestamps {
-					line := []string{}
-					line = append(line, ts.Format("2006/01/02"))
-
-					if r.MetricErrors[m.ID][i] == nil {
-						line = append(line, fmt.Sprintf("%d", r.Metrics[m.ID][i]))
-					} else {
-						line = append(line, "-")
-					}
-					line = append(line, m.Category)
-					line = append(line, m.Name)
-					for _, k := range r.Config.Metadata.FieldList {
-						if v, exists := m.Metadata[k]; exists {
-							line = append(line, fmt.Sprintf("%s", v))
-						} else {
-							line = append(line, "-")
-						}
-					}
-
-					line = append(line, m.ID)
-					sb.WriteString(strings.Join(line, sp) + "\n")
-				}
+			for _, m := range metric.queries() {
+				r.collectMetric(m, ts)
 			}
 		}
+		r.streamMetrics(timestamps[:i+1], streamed, false)
 	}
+	r.streamMetrics(timestamps, streamed, true)
+}
 
-	if r.Config.Output.Format == "json" || r.Config.Output.Format == "js" {
-		if r.Config.Output.Format == "js" {
-			sb.WriteString("var metricsDataset = ")
+// streamMetrics writes the records of the points of the metrics which are
+// final once the provided periods are collected, and the remaining points
+// when the run is done. The points are the ones of the outputs, i.e. filled
+// according to the missing data policy, transformed and checked for
+// anomalies, which look back only. The points are final except for the
+// periods following the last value of a metric with interpolate policy,
+// and the last period of the rollups, which wait for the later periods.
+// The streamed counts are the numbers of the points written per metric.
+func (r *QueryRunner) streamMetrics(timestamps []time.Time, streamed map[string]int, done bool) {
+	if r.Stream == nil {
+		return
+	}
+	for _, m := range r.Config.Metrics {
+		if m.Disabled {
+			continue
 		}
-		sb.WriteString("{\n")
-		metricDefinitions, err := json.MarshalIndent(r.Config.Metrics, r.offset(1), r.offset(1))
-		if err != nil {
-			return "", err
+		final := timestamps
+		if !done && r.missingDataPolicy(m) == "interpolate" {
+			values, errs := seriesOf(m, r.Metrics, r.MetricErrors)
+			n := len(final)
+			for n > 0 && (n > len(values) || errs[n-1] != nil) {
+				n--
+			}
+			final = final[:n]
 		}
-		sb.WriteString(r.offset(1) + `"metric_definitions": ` + string(metricDefinitions) + ",\n")
-		metricTimestamps := []string{}
-		for _, ts := range r.Config.Timestamps {
-			metricTimestamps = append(metricTimestamps, fmt.Sprintf("%d000", ts.Unix()))
+		points := r.pointsOf(m, final, nil)
+		n := len(points)
+		if !done && hasRollup(r.transformsOf(m, nil)) && n > 0 {
+			n--
 		}
-		sb.WriteString(r.offset(1) + `"timestamps": [` + strings.Join(metricTimestamps, ", ") + "],\n")
-		sb.WriteString(r.offset(1) + `"metrics": [` + "\n")
-		for j, m := range r.Config.Metrics {
-			isLastMetricElement := false
-			if len(r.Config.Metrics)-1 == j {
-				isLastMetricElement = true
-			}
-			if m.Disabled {
-				continue
-			}
-			sb.WriteString(r.offset(2) + "{\n")
-			sb.WriteString(r.offset(3) + fmt.Sprintf(`"%s": {`, m.ID) + "\n")
-			sb.WriteString(r.offset(4) + `"counters": [`)
-			for i := range r.Config.Timestamps {
-				isLastElement := false
-				if len(r.Config.Timestamps)-1 == i {
-					isLastElement = true
-				}
-				if r.MetricErrors[m.ID][i] == nil {
-					sb.WriteString(fmt.Sprintf("%d", r.Metrics[m.ID][i]))
-				} else {
-					sb.WriteString("null")
-				}
-				if !isLastElement {
-					sb.WriteString(", ")
-				}
+		for ; streamed[m.ID] < n; streamed[m.ID]++ {
+			if err := r.Stream.Write(newMetricRecord(r.RunID, m, points[streamed[m.ID]])); err != nil {
+				log.Warnf("failed streaming metric record: %s", err)
 			}
-			sb.WriteString("],\n")
-			calc := calculator.NewUint64(r.Metrics[m.ID])
-			calc.RunAll()
-			sb.WriteString(r.offset(4) + fmt.Sprintf(`"total": %.2f,`, calc.Register.Total) + "\n")
-			sb.WriteString(r.offset(4) + fmt.Sprintf(`"max": %.2f,`, calc.Register.MaxValue) + "\n")
-			sb.WriteString(r.offset(4) + fmt.Sprintf(`"min": %.2f,`, calc.Register.MinValue) + "\n")
-			sb.WriteString(r.offset(4) + fmt.Sprintf(`"mean": %.2f,`, calc.Register.Mean) + "\n")
-			sb.WriteString(r.offset(4) + fmt.Sprintf(`"median": %.2f,`, calc.Register.Median) + "\n")
-			sb.WriteString(r.offset(4) + `"modes": [`)
-			if len(calc.Register.Modes) == 1000000 {
-				rml := len(calc.Register.Modes) - 1
-				for ri, rm := range calc.Register.Modes {
-					sb.WriteString(fmt.Sprintf("%.2f", rm))
-					if rml != ri {
-						sb.WriteString(", ")
-					}
-				}
-			}
-			sb.WriteString("],\n")
-			sb.WriteString(r.offset(4) + fmt.Sprintf(`"range": %.2f`, calc.Register.Range) + "\n")
+		}
+	}
+}
+
+// collectMetric gets the value of a metric for a daily period.
+func (r *QueryRunner) collectMetric(m *Metric, ts time.Time) {
+	if m.IndexSplit != "daily" {
+		return
+	}
+	if _, exists := r.Metrics[m.ID]; !exists {
+		r.Metrics[m.ID] = []uint64{}
+	}
+	if _, exists := r.MetricErrors[m.ID]; !exists {
+		r.MetricErrors[m.ID] = []error{}
+	}
+	total, err := r.count(m, ts)
+	if err != nil {
+		r.Summary.Errors++
+		r.Metrics[m.ID] = append(r.Metrics[m.ID], 0)
+		r.MetricErrors[m.ID] = append(r.MetricErrors[m.ID], err)
+		return
+	}
+	r.Metrics[m.ID] = append(r.Metrics[m.ID], total)
+	r.MetricErrors[m.ID] = append(r.MetricErrors[m.ID], nil)
+}
 
-			sb.WriteString(r.offset(3) + "}\n")
-			if !isLastMetricElement {
-				sb.WriteString(r.offset(2) + "},\n")
-			} else {
-				sb.WriteString(r.offset(2) + "}\n")
+// count returns the value of a metric for a daily period. The periods
+// present in the history are not queried. The results of settled periods
+// are served from and saved to the cache, and recorded in the history.
+func (r *QueryRunner) count(m *Metric, ts time.Time) (uint64, error) {
+	if r.history != nil {
+		if total, hit := r.history.Get(m, ts, r.cluster); hit {
+			r.Summary.HistoryHits++
+			return total, nil
+		}
+		if r.Config.History.ReadOnly {
+			return 0, fmt.Errorf("no history record for metric %s, period %s", m.ID, ts.Format("2006-01-02"))
+		}
+	}
+	suffix := fmt.Sprintf("%d%02d%02d", ts.Year(), ts.Month(), ts.Day())
+	var key string
+	if r.cache != nil && r.Config.Cache.Settled(ts, time.Now()) {
+		key = cacheKey(r.cluster, m, m.BaseIndex+suffix, ts)
+		if !r.Config.Cache.Refresh {
+			if total, hit := r.cache.Get(key); hit {
+				r.Summary.CacheHits++
+				r.record(m, ts, total)
+				return total, nil
 			}
-			//sb.WriteString("]\n")
 		}
+		r.Summary.CacheMisses++
+	}
+	r.Summary.Queries++
+	count, err := r.client.Count(m, suffix)
+	if err != nil {
+		return 0, err
+	}
+	if key != "" {
+		r.cache.Put(key, count.Total)
+	}
+	r.record(m, ts, count.Total)
+	return count.Total, nil
+}
 
-		//			sb.WriteString(r.offset(2) + fmt.Sprintf("%d", ts.Unix()) + "000,\n")
-
-		//sb.WriteString(r.offset(2) + "]\n")
-		sb.WriteString(r.offset(1) + "]\n")
-		sb.WriteString("}\n")
+// record appends the value of a settled period to the history.
+func (r *QueryRunner) record(m *Metric, ts time.Time, total uint64) {
+	if r.history == nil || !r.Config.History.Settled(ts, time.Now()) {
+		return
+	}
+	if err := r.history.Append(m, ts, total, r.cluster); err != nil {
+		log.Warnf("failed recording history: %s", err)
 	}
+}
 
+// Output returns metrics data.
+func (r *QueryRunner) Output() (string, error) {
+	var sb strings.Builder
+	opts := &renderOptions{
+		Format:     r.Config.Output.Format,
+		Landscape:  r.Config.Output.Landscape,
+		Template:   r.Config.Output.Template,
+		Statistics: r.Config.Output.Statistics,
+		Grouping:   r.Config.Output.Grouping,
+		Timestamps: r.Config.Output.Timestamps,
+	}
+	if err := r.render(&sb, opts); err != nil {
+		return "", err
+	}
 	return sb.String(), nil
 }
 
+// renderOptions are the options of rendering metric data. The statistics
+// are the names of the summary statistics in tabular outputs, the defaults
+// of the format when empty, and the grouping is the order and the grouping
+// of the metrics in tabular outputs. The timestamps are the timestamps of
+// the samples in Prometheus outputs.
+type renderOptions struct {
+	Format     string
+	Landscape  bool
+	Template   string
+	Statistics []string
+	Transforms []*TransformConfig
+	Grouping   *GroupingConfig
+	Timestamps bool
+}
+
+// render writes metric data in the provided format.
+func (r *QueryRunner) render(w io.Writer, opts *renderOptions) error {
+	if _, exists := supportedOutputFormats[opts.Format]; !exists {
+		return fmt.Errorf("the following output format is not supported: %s", opts.Format)
+	}
+	var sb strings.Builder
+	switch opts.Format {
+	case "csv":
+		return r.outputCSV(w, opts)
+	case "prometheus", "openmetrics":
+		r.outputPrometheus(&sb, opts)
+	case "ndjson":
+		return r.outputNDJSON(w, opts)
+	case "xlsx":
+		return r.outputXLSX(w, opts)
+	case "html":
+		return r.outputHTML(w, opts)
+	case "markdown":
+		return r.outputMarkdown(w, opts)
+	case "table":
+		return r.outputTable(w, opts)
+	case "template":
+		if opts.Template == "" {
+			return fmt.Errorf("template output format requires template file")
+		}
+		return r.outputTemplate(w, opts)
+	case "influx":
+		r.outputInflux(&sb, opts.Transforms)
+	case "graphite":
+		r.outputGraphite(&sb, "esqrunner", opts.Transforms)
+	case "json", "js":
+		if opts.Format == "js" {
+			sb.WriteString("var metricsDataset = ")
+		}
+		data, err := json.MarshalIndent(r.report(opts.Transforms), "", r.offset(1))
+		if err != nil {
+			return err
+		}
+		sb.Write(data)
+		if opts.Format == "js" {
+			sb.WriteString(";")
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
 func (r *QueryRunner) offset(j int) string {
 	var offset string
 	for i := 0; i < j; i++ {
@@ -335,54 +490,3 @@ func (r *QueryRunner) GetOutputFilePrefix(outputDir, outputFilePrefix string) (s
 	}
 	return filepath.Join(outputDir, outputFilePrefix), nil
 }
-
-// WriteToFiles outputs data in various formats, e.g. JSON, CSV, etc.
-func (r *QueryRunner) WriteToFiles(fp string) ([]string, error) {
-	outputFiles := []string{}
-	r.Config.Output.Format = "csv"
-	r.Config.Output.Landscape = true
-	out, err := r.Output()
-	if err != nil {
-		return outputFiles, err
-	}
-	outputFile := fmt.Sprintf("%s_landscape.%s", fp, r.Config.Output.Format)
-	if err := writeToFile(outputFile, out); err != nil {
-		return outputFiles, err
-	}
-	outputFiles = append(outputFiles, outputFile)
-
-	r.Config.Output.Landscape = false
-	out, err = r.Output()
-	if err != nil {
-		return outputFiles, err
-	}
-	outputFile = fmt.Sprintf("%s_portrait.%s", fp, r.Config.Output.Format)
-	if err := writeToFile(outputFile, out); err != nil {
-		return outputFiles, err
-	}
-	outputFiles = append(outputFiles, outputFile)
-
-	r.Config.Output.Format = "json"
-	out, err = r.Output()
-	if err != nil {
-		return outputFiles, err
-	}
-	outputFile = fmt.Sprintf("%s.%s", fp, r.Config.Output.Format)
-	if err := writeToFile(outputFile, out); err != nil {
-		return outputFiles, err
-	}
-	outputFiles = append(outputFiles, outputFile)
-
-	r.Config.Output.Format = "js"
-	out, err = r.Output()
-	if err != nil {
-		return outputFiles, err
-	}
-	outputFile = fmt.Sprintf("%s.%s", fp, r.Config.Output.Format)
-	if err := writeToFile(outputFile, out); err != nil {
-		return outputFiles, err
-	}
-	outputFiles = append(outputFiles, outputFile)
-
-	return outputFiles, nil
-}
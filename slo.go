@@ -0,0 +1,375 @@
+package esqrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"time"
+)
+
+// SLOConfig is the configuration of a service level objective metric. The
+// good and the total events are counted either by the good and the total
+// queries, run against the indices of the metric, or by the good and the
+// total metrics, referenced by their IDs. The target is the percentage of
+// the good events, e.g. 99.9, and the window is the number of the days of
+// the rolling window, 28 by default, ending with the last date of a run.
+type SLOConfig struct {
+	GoodQuery   *json.RawMessage `json:"good_query,omitempty" yaml:"good_query"`
+	TotalQuery  *json.RawMessage `json:"total_query,omitempty" yaml:"total_query"`
+	GoodMetric  string           `json:"good_metric,omitempty" yaml:"good_metric"`
+	TotalMetric string           `json:"total_metric,omitempty" yaml:"total_metric"`
+	Target      float64          `json:"target" yaml:"target"`
+	Window      int              `json:"window,omitempty" yaml:"window"`
+	Alerts      []*BurnRateAlert `json:"alerts,omitempty" yaml:"alerts"`
+	good        *Metric
+	total       *Metric
+}
+
+// BurnRateAlert is a multi-window burn rate alert. The alert fires when
+// the burn rates over both the long and the short windows, in days, reach
+// the burn rate. The burn rate is the ratio of the rate of the bad events
+// to the rate allowed by the target, i.e. the burn rate of 1 spends the
+// error budget exactly over the window.
+type BurnRateAlert struct {
+	Level       string  `json:"level" yaml:"level"`
+	LongWindow  int     `json:"long_window" yaml:"long_window"`
+	ShortWindow int     `json:"short_window" yaml:"short_window"`
+	BurnRate    float64 `json:"burn_rate" yaml:"burn_rate"`
+}
+
+// SLOStatus is the status of a service level objective over the rolling
+// window. The error budget is the number of the bad events allowed by the
+// target, and the remaining budget is its percentage not spent, negative
+// when the budget is exhausted. The days are the days of the window within
+// the run, and the status is partial when the run is shorter than the
+// window, i.e. the events of the days before the run are not counted.
+type SLOStatus struct {
+	Target          float64                `json:"target"`
+	Window          int                    `json:"window"`
+	Days            int                    `json:"days"`
+	Partial         bool                   `json:"partial,omitempty"`
+	Good            uint64                 `json:"good"`
+	Total           uint64                 `json:"total"`
+	Attainment      *float64               `json:"attainment"`
+	ErrorBudget     float64                `json:"error_budget"`
+	BudgetRemaining *float64               `json:"budget_remaining"`
+	BurnRate        *float64               `json:"burn_rate"`
+	Periods         []*SLOPeriod           `json:"periods"`
+	Alerts          []*BurnRateAlertResult `json:"alerts,omitempty"`
+}
+
+// SLOPeriod holds the events of a service level objective for a period.
+type SLOPeriod struct {
+	Period     *ReportPeriod `json:"period"`
+	Good       uint64        `json:"good"`
+	Total      uint64        `json:"total"`
+	Attainment *float64      `json:"attainment"`
+	BurnRate   *float64      `json:"burn_rate"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// BurnRateAlertResult is the outcome of a burn rate alert. The outcome is
+// partial when the run is shorter than the long window of the alert.
+type BurnRateAlertResult struct {
+	Alert   *BurnRateAlert `json:"alert"`
+	Long    *float64       `json:"long"`
+	Short   *float64       `json:"short"`
+	Fired   bool           `json:"fired"`
+	Partial bool           `json:"partial,omitempty"`
+}
+
+// Validate validates SLOConfig.
+func (c *SLOConfig) Validate() error {
+	byQuery := c.GoodQuery != nil || c.TotalQuery != nil
+	byMetric := c.GoodMetric != "" || c.TotalMetric != ""
+	switch {
+	case byQuery && byMetric:
+		return fmt.Errorf("slo must have either queries or metrics, not both")
+	case byQuery && (c.GoodQuery == nil || c.TotalQuery == nil):
+		return fmt.Errorf("slo must have good and total queries")
+	case byMetric && (c.GoodMetric == "" || c.TotalMetric == ""):
+		return fmt.Errorf("slo must have good and total metrics")
+	case !byQuery && !byMetric:
+		return fmt.Errorf("slo has no queries or metrics")
+	}
+	if c.Target <= 0 || c.Target >= 100 {
+		return fmt.Errorf("slo target must be between 0 and 100: %v", c.Target)
+	}
+	if c.Window == 0 {
+		c.Window = 28
+	}
+	if c.Window < 1 {
+		return fmt.Errorf("slo window must be positive: %d", c.Window)
+	}
+	for _, a := range c.Alerts {
+		if a == nil {
+			return fmt.Errorf("slo alert is empty")
+		}
+		if a.Level != LevelWarning && a.Level != LevelCritical {
+			return fmt.Errorf("slo alert level is unsupported: %s", a.Level)
+		}
+		if a.ShortWindow < 1 || a.LongWindow < a.ShortWindow {
+			return fmt.Errorf("slo alert windows are invalid: long %d, short %d", a.LongWindow, a.ShortWindow)
+		}
+		if a.BurnRate <= 0 {
+			return fmt.Errorf("slo alert burn rate must be positive: %v", a.BurnRate)
+		}
+	}
+	return nil
+}
+
+// resolve sets the metrics counting the good and the total events. The
+// queries become the metrics with the index of the SLO metric.
+func (c *SLOConfig) resolve(m *Metric, refs map[string]*Metric) error {
+	if c.GoodQuery != nil {
+		c.good, c.total = m.eventMetric("good", c.GoodQuery), m.eventMetric("total", c.TotalQuery)
+		return nil
+	}
+	for _, id := range []string{c.GoodMetric, c.TotalMetric} {
+		ref, exists := refs[id]
+		if !exists {
+			return fmt.Errorf("slo metric not found: %s", id)
+		}
+		if ref.SLO != nil {
+			return fmt.Errorf("slo metric references another slo metric: %s", id)
+		}
+		if ref.Disabled {
+			return fmt.Errorf("slo metric is disabled: %s", id)
+		}
+	}
+	c.good, c.total = refs[c.GoodMetric], refs[c.TotalMetric]
+	return nil
+}
+
+// eventMetric returns the metric counting the events of an SLO metric with
+// the query.
+func (m *Metric) eventMetric(kind string, query *json.RawMessage) *Metric {
+	return &Metric{
+		ID:          m.ID + "/" + kind,
+		Category:    m.Category,
+		Name:        m.Name + " (" + kind + ")",
+		Description: m.Description,
+		Operation:   m.Operation,
+		BaseIndex:   m.BaseIndex,
+		IndexSplit:  m.IndexSplit,
+		Function:    m.Function,
+		Query:       query,
+	}
+}
+
+// queries returns the metrics to query for the metric: the metric itself,
+// the metrics of the good and the total queries of an SLO metric, or none
+// when the SLO metric references other metrics.
+func (m *Metric) queries() []*Metric {
+	if m.SLO == nil {
+		return []*Metric{m}
+	}
+	if m.SLO.GoodQuery != nil {
+		return []*Metric{m.SLO.good, m.SLO.total}
+	}
+	return nil
+}
+
+// seriesOf returns the collected values and errors of a metric. The values
+// of an SLO metric are the percentages of the good events, and the periods
+// without events have no values.
+func seriesOf(m *Metric, metrics map[string][]uint64, errs map[string][]error) ([]float64, []error) {
+	if m.SLO == nil || m.SLO.good == nil {
+		values := []float64{}
+		for _, v := range metrics[m.ID] {
+			values = append(values, float64(v))
+		}
+		return values, errs[m.ID]
+	}
+	good, total := metrics[m.SLO.good.ID], metrics[m.SLO.total.ID]
+	values, series := []float64{}, []error{}
+	for i := 0; i < len(good) && i < len(total); i++ {
+		var err error
+		switch {
+		case errs[m.SLO.good.ID][i] != nil:
+			err = errs[m.SLO.good.ID][i]
+		case errs[m.SLO.total.ID][i] != nil:
+			err = errs[m.SLO.total.ID][i]
+		case total[i] == 0:
+			err = fmt.Errorf("no events")
+		}
+		if err != nil {
+			values, series = append(values, 0), append(series, err)
+			continue
+		}
+		values = append(values, float64(good[i])*100/float64(total[i]))
+		series = append(series, nil)
+	}
+	return values, series
+}
+
+// sloStatus returns the status of an SLO metric over the rolling window
+// ending with the last date of the run.
+func (r *QueryRunner) sloStatus(m *Metric) *SLOStatus {
+	c := m.SLO
+	if c == nil || c.good == nil {
+		return nil
+	}
+	status := &SLOStatus{Target: c.Target, Window: c.Window, Periods: []*SLOPeriod{}}
+	good, total := r.Metrics[c.good.ID], r.Metrics[c.total.ID]
+	for i, ts := range r.Config.Timestamps {
+		p := &SLOPeriod{Period: periodOf(ts)}
+		switch {
+		case i >= len(good) || i >= len(total):
+			p.Error = "no data"
+		case r.MetricErrors[c.good.ID][i] != nil:
+			p.Error = r.MetricErrors[c.good.ID][i].Error()
+		case r.MetricErrors[c.total.ID][i] != nil:
+			p.Error = r.MetricErrors[c.total.ID][i].Error()
+		case total[i] == 0:
+			p.Error = "no events"
+		default:
+			p.Good, p.Total = good[i], total[i]
+			p.Attainment, p.BurnRate = c.attainment(p.Good, p.Total)
+		}
+		status.Periods = append(status.Periods, p)
+	}
+	if len(status.Periods) == 0 {
+		return status
+	}
+	last := status.Periods[len(status.Periods)-1].Period.Start
+	status.Days = windowDays(status.Periods, last, c.Window)
+	status.Partial = status.Days < c.Window
+	status.Good, status.Total = c.events(status.Periods, last, c.Window)
+	status.Attainment, status.BurnRate = c.attainment(status.Good, status.Total)
+	status.ErrorBudget = float64(status.Total) * (100 - c.Target) / 100
+	if status.ErrorBudget > 0 {
+		remaining := (1 - (float64(status.Total)-float64(status.Good))/status.ErrorBudget) * 100
+		status.BudgetRemaining = &remaining
+	}
+	for _, a := range c.Alerts {
+		res := &BurnRateAlertResult{Alert: a, Partial: windowDays(status.Periods, last, a.LongWindow) < a.LongWindow}
+		_, res.Long = c.attainment(c.events(status.Periods, last, a.LongWindow))
+		_, res.Short = c.attainment(c.events(status.Periods, last, a.ShortWindow))
+		res.Fired = res.Long != nil && res.Short != nil && *res.Long >= a.BurnRate && *res.Short >= a.BurnRate
+		status.Alerts = append(status.Alerts, res)
+	}
+	return status
+}
+
+// windowDays returns the number of the periods within the window of days
+// ending with the last day.
+func windowDays(periods []*SLOPeriod, last time.Time, window int) int {
+	n := 0
+	from := last.AddDate(0, 0, 1-window)
+	for _, p := range periods {
+		if !p.Period.Start.Before(from) && !p.Period.Start.After(last) {
+			n++
+		}
+	}
+	return n
+}
+
+// warnPartialWindows logs a warning for each SLO metric with the window,
+// or the long window of a burn rate alert, longer than the run, since the
+// events before the run are not counted.
+func (r *QueryRunner) warnPartialWindows() {
+	n := len(r.Config.Timestamps)
+	for _, m := range r.Config.Metrics {
+		if m.Disabled || m.SLO == nil {
+			continue
+		}
+		window := m.SLO.Window
+		for _, a := range m.SLO.Alerts {
+			if a.LongWindow > window {
+				window = a.LongWindow
+			}
+		}
+		if window > n {
+			log.Warnf("slo metric %s has the window of %d days, and the run of %d days, the status is partial", m.ID, window, n)
+		}
+	}
+}
+
+// validateSLOTransforms validates the transformations of an SLO metric.
+// The values are percentages, which neither add up nor accumulate, hence
+// the sum rollups, the cumulative sums and the rates are not allowed.
+func validateSLOTransforms(transforms []*TransformConfig) error {
+	for _, t := range transforms {
+		switch {
+		case t.Rollup != "" && t.Aggregate == "sum":
+			return fmt.Errorf("transform rollup with sum aggregate is not supported by slo metrics")
+		case t.CumulativeSum:
+			return fmt.Errorf("transform cumulative sum is not supported by slo metrics")
+		case t.Rate != "":
+			return fmt.Errorf("transform rate is not supported by slo metrics")
+		}
+	}
+	return nil
+}
+
+// events returns the good and the total events of the periods within the
+// window of days ending with the last day. The periods with errors are
+// left out.
+func (c *SLOConfig) events(periods []*SLOPeriod, last time.Time, days int) (uint64, uint64) {
+	var good, total uint64
+	from := last.AddDate(0, 0, 1-days)
+	for _, p := range periods {
+		if p.Error != "" || p.Period.Start.Before(from) || p.Period.Start.After(last) {
+			continue
+		}
+		good += p.Good
+		total += p.Total
+	}
+	return good, total
+}
+
+// attainment returns the percentage of the good events and the burn rate,
+// or nil when there are no events.
+func (c *SLOConfig) attainment(good, total uint64) (*float64, *float64) {
+	if total == 0 {
+		return nil, nil
+	}
+	attainment := float64(good) * 100 / float64(total)
+	burn := (100 - attainment) / (100 - c.Target)
+	return &attainment, &burn
+}
+
+// burnRateResults returns the outcomes of the burn rate alerts of an SLO
+// metric as the results of threshold rules. The value is the lower of the
+// burn rates of the windows, which reaches the burn rate of the alert
+// when both do.
+func burnRateResults(result *MetricResult) []*ThresholdResult {
+	results := []*ThresholdResult{}
+	if result.SLO == nil {
+		return results
+	}
+	for _, a := range result.SLO.Alerts {
+		rule := &ThresholdRule{
+			Name:     fmt.Sprintf("burn rate over %d and %d days >= %s", a.Alert.LongWindow, a.Alert.ShortWindow, formatValue(a.Alert.BurnRate)),
+			On:       "burn_rate",
+			Operator: ">=",
+		}
+		level := a.Alert.BurnRate
+		if a.Alert.Level == LevelCritical {
+			rule.Critical = &level
+		} else {
+			rule.Warning = &level
+		}
+		res := &ThresholdResult{
+			MetricID: result.ID,
+			Category: result.Category,
+			Name:     result.Name,
+			Rule:     rule,
+			Level:    LevelOK,
+		}
+		if a.Long != nil && a.Short != nil {
+			v := math.Min(*a.Long, *a.Short)
+			res.Value = &v
+		}
+		if a.Fired {
+			res.Level, res.Limit = a.Alert.Level, &level
+		}
+		if n := len(result.SLO.Periods); n > 0 {
+			res.Period = result.SLO.Periods[n-1].Period
+		}
+		results = append(results, res)
+	}
+	return results
+}
@@ -0,0 +1,176 @@
+package esqrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSLOQueries(t *testing.T) {
+	good := map[string]uint64{"tickets-20200301": 999, "tickets-20200302": 990, "tickets-20200303": 1000}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/" {
+			fmt.Fprintf(w, `{"cluster_name":"test","cluster_uuid":"test-uuid","version":{"number":"7.17.10"}}`)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		index := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")[0]
+		if strings.Contains(string(body), "good") {
+			fmt.Fprintf(w, `{"count":%d}`, good[index])
+			return
+		}
+		fmt.Fprintf(w, `{"count":1000}`)
+	}))
+	defer srv.Close()
+
+	r := newTestRunner(t, srv.URL)
+	if err := r.ValidateConfig(); err != nil {
+		t.Fatal(err)
+	}
+	goodQuery := json.RawMessage(`{"query":{"match":{"status":"good"}}}`)
+	totalQuery := json.RawMessage(`{"query":{"match_all":{}}}`)
+	base := r.Config.Metrics[0]
+	m := &Metric{
+		ID:          "slo-1",
+		Category:    base.Category,
+		Name:        "Availability",
+		Description: "Good requests",
+		Operation:   base.Operation,
+		BaseIndex:   base.BaseIndex,
+		IndexSplit:  base.IndexSplit,
+		Function:    base.Function,
+		Type:        "slo",
+		SLO: &SLOConfig{
+			GoodQuery:  &goodQuery,
+			TotalQuery: &totalQuery,
+			Target:     99.9,
+			Alerts: []*BurnRateAlert{
+				{Level: LevelCritical, LongWindow: 3, ShortWindow: 1, BurnRate: 3},
+				{Level: LevelWarning, LongWindow: 3, ShortWindow: 2, BurnRate: 2},
+			},
+		},
+	}
+	if err := m.Valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SLO.resolve(m, r.Config.MetricRef); err != nil {
+		t.Fatal(err)
+	}
+	r.Config.Metrics = append(r.Config.Metrics, m)
+	var buf bytes.Buffer
+	r.Stream = NewNDJSONWriter(&buf)
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if streamed := buf.String(); strings.Contains(streamed, "slo-1/") || !strings.Contains(streamed, `"metric_id":"slo-1","category":"Helpdesk","name":"Availability","period":{"start":"2020-03-01T00:00:00Z","end":"2020-03-02T00:00:00Z"},"value":99.9}`) ||
+		strings.Contains(streamed, `"value":999}`) {
+		t.Fatalf("expected stream of attainments:\n%s", streamed)
+	}
+
+	report := r.Report()
+	result := report.Metrics[1]
+	for i, v := range []float64{99.9, 99, 100} {
+		if math.Abs(*result.Points[i].Value-v) > 1e-9 {
+			t.Fatalf("unexpected attainment of period %d: %v", i, *result.Points[i].Value)
+		}
+	}
+	s := result.SLO
+	if s.Good != 2989 || s.Total != 3000 || math.Abs(*s.Attainment-99.63333) > 1e-4 ||
+		math.Abs(*s.BurnRate-3.66667) > 1e-4 || math.Abs(*s.BudgetRemaining+266.66667) > 1e-4 {
+		t.Fatalf("unexpected slo status: %+v", s)
+	}
+	if s.Days != 3 || !s.Partial || s.Alerts[0].Partial {
+		t.Fatalf("unexpected slo window of the run: %+v", s)
+	}
+	if s.Alerts[0].Fired || !s.Alerts[1].Fired || *s.Periods[1].BurnRate < 9.99 {
+		t.Fatalf("unexpected burn rate alerts: %+v, %+v", s.Alerts[0], s.Alerts[1])
+	}
+	if report.Evaluation.Status != LevelWarning || report.Evaluation.ExitCode() != ExitWarning || len(report.Evaluation.Fired()) != 1 {
+		t.Fatalf("unexpected evaluation: %+v", report.Evaluation)
+	}
+	r.Config.Output.Format = "html"
+	if out, err := r.Output(); err != nil || !strings.Contains(out, "Target 99.90% over 28 days: attainment 99.63%") || !strings.Contains(out, "partial window of 3 days") {
+		t.Fatalf("html output has no slo: %v\n%s", err, out)
+	}
+}
+
+func TestSLOMetrics(t *testing.T) {
+	r := newTestOutputRunner(t)
+	total := &Metric{
+		ID: "total", Category: "Service", Name: "Requests", Description: "Requests",
+		Operation: "GET", BaseIndex: "requests-", IndexSplit: "daily", Function: "_count",
+	}
+	m := &Metric{
+		ID: "slo-2", Category: "Service", Name: "Success", Description: "Successful requests",
+		Type: "slo", SLO: &SLOConfig{GoodMetric: r.Config.Metrics[0].ID, TotalMetric: "total", Target: 90},
+	}
+	if err := m.Valid(); err != nil {
+		t.Fatal(err)
+	}
+	r.Config.MetricRef["total"] = total
+	if err := m.SLO.resolve(m, r.Config.MetricRef); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.queries()) != 0 {
+		t.Fatalf("expected no queries of slo referencing metrics")
+	}
+	r.Config.Metrics = append(r.Config.Metrics, total, m)
+	r.Metrics["total"] = []uint64{10, 40, 0}
+	r.MetricErrors["total"] = []error{nil, nil, nil}
+
+	result := r.Report().Metrics[2]
+	if *result.Points[0].Value != 100 || result.Points[1].Error != "index not found" || result.Points[2].Error != "no events" {
+		t.Fatalf("unexpected slo points: %+v, %+v, %+v", result.Points[0], result.Points[1], result.Points[2])
+	}
+	if result.SLO.Total != 10 || *result.SLO.Attainment != 100 || r.Report().Evaluation != nil {
+		t.Fatalf("unexpected slo status: %+v", result.SLO)
+	}
+
+	for _, c := range []*SLOConfig{
+		{},
+		{GoodMetric: "a", Target: 99},
+		{GoodMetric: "a", TotalMetric: "b", GoodQuery: &json.RawMessage{}, Target: 99},
+		{GoodMetric: "a", TotalMetric: "b", Target: 100},
+		{GoodMetric: "a", TotalMetric: "b", Target: 99, Alerts: []*BurnRateAlert{{Level: "info", LongWindow: 1, ShortWindow: 1, BurnRate: 1}}},
+		{GoodMetric: "a", TotalMetric: "b", Target: 99, Alerts: []*BurnRateAlert{{Level: LevelWarning, LongWindow: 1, ShortWindow: 2, BurnRate: 1}}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected slo config %+v to fail validation", c)
+		}
+	}
+	// The window is partial when the run is shorter.
+	m.SLO.Window = 3
+	m.SLO.Alerts = []*BurnRateAlert{{Level: LevelWarning, LongWindow: 7, ShortWindow: 1, BurnRate: 100}}
+	if s := r.Report().Metrics[2].SLO; s.Days != 3 || s.Partial || !s.Alerts[0].Partial {
+		t.Fatalf("unexpected partial windows: %+v, %+v", s, s.Alerts[0])
+	}
+
+	for _, transforms := range [][]*TransformConfig{
+		{{Rollup: "week", Aggregate: "sum"}},
+		{{CumulativeSum: true}},
+		{{Rate: "day"}},
+	} {
+		if err := validateSLOTransforms(transforms); err == nil {
+			t.Fatalf("expected slo transforms %+v to fail validation", transforms[0])
+		}
+	}
+	if err := validateSLOTransforms([]*TransformConfig{{Rollup: "week", Aggregate: "avg"}, {MovingAverage: 7}}); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := &SLOConfig{GoodMetric: "total", TotalMetric: "unknown", Target: 99}
+	if err := missing.resolve(m, r.Config.MetricRef); err == nil {
+		t.Fatalf("expected slo referencing unknown metric to fail")
+	}
+	if err := (&Metric{ID: "x", Category: "c", Name: "n", Description: "d", Type: "slo"}).Valid(); err == nil {
+		t.Fatalf("expected slo metric without slo to fail")
+	}
+}
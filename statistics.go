@@ -0,0 +1,169 @@
+package esqrunner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// summaryStatistic is a statistic of MetricSummary, which could be chosen
+// to appear in tabular outputs. The value is float64, int, []float64, or nil
+// when the statistic is undefined, e.g. the percent change from zero. The
+// Excel formula, when set, takes the range of the values as the argument.
+// The unitless statistics, e.g. variance, are not in the unit of the metric.
+type summaryStatistic struct {
+	name     string
+	title    string
+	value    func(s *MetricSummary) interface{}
+	excel    string
+	unitless bool
+}
+
+// summaryStatistics are the statistics available in the outputs.
+var summaryStatistics = []*summaryStatistic{
+	{name: "total", title: "Total", value: func(s *MetricSummary) interface{} { return s.Total }, excel: "SUM(%s)"},
+	{name: "max", title: "Max", value: func(s *MetricSummary) interface{} { return s.Max }, excel: "MAX(%s)"},
+	{name: "min", title: "Min", value: func(s *MetricSummary) interface{} { return s.Min }, excel: "MIN(%s)"},
+	{name: "mean", title: "Average", value: func(s *MetricSummary) interface{} { return s.Mean }, excel: "IFERROR(AVERAGE(%s),0)"},
+	{name: "median", title: "Median", value: func(s *MetricSummary) interface{} { return s.Median }, excel: "IFERROR(MEDIAN(%s),0)"},
+	{name: "modes", title: "Modes", value: func(s *MetricSummary) interface{} { return s.Modes }},
+	{name: "range", title: "Range", value: func(s *MetricSummary) interface{} { return s.Range }, excel: "MAX(%[1]s)-MIN(%[1]s)"},
+	{name: "stddev", title: "Std Dev", value: func(s *MetricSummary) interface{} { return s.StdDev }, excel: "IFERROR(STDEVP(%s),0)"},
+	{name: "variance", title: "Variance", value: func(s *MetricSummary) interface{} { return s.Variance }, excel: "IFERROR(VARP(%s),0)", unitless: true},
+	{name: "p50", title: "P50", value: func(s *MetricSummary) interface{} { return s.P50 }, excel: "IFERROR(PERCENTILE(%s,0.5),0)"},
+	{name: "p90", title: "P90", value: func(s *MetricSummary) interface{} { return s.P90 }, excel: "IFERROR(PERCENTILE(%s,0.9),0)"},
+	{name: "p95", title: "P95", value: func(s *MetricSummary) interface{} { return s.P95 }, excel: "IFERROR(PERCENTILE(%s,0.95),0)"},
+	{name: "p99", title: "P99", value: func(s *MetricSummary) interface{} { return s.P99 }, excel: "IFERROR(PERCENTILE(%s,0.99),0)"},
+	{name: "cv", title: "CV", value: func(s *MetricSummary) interface{} { return optionalValue(s.CV) }, unitless: true},
+	{name: "valid", title: "Valid", value: func(s *MetricSummary) interface{} { return s.Valid }, excel: "COUNT(%s)"},
+	{name: "missing", title: "Missing", value: func(s *MetricSummary) interface{} { return s.Missing }},
+	{name: "excluded", title: "Excluded", value: func(s *MetricSummary) interface{} { return s.Excluded }, excel: "COUNTBLANK(%s)"},
+	{name: "filled", title: "Filled", value: func(s *MetricSummary) interface{} { return s.Filled }},
+	{name: "first", title: "First", value: func(s *MetricSummary) interface{} { return optionalValue(s.First) }},
+	{name: "last", title: "Last", value: func(s *MetricSummary) interface{} { return optionalValue(s.Last) }},
+	{name: "change", title: "Change", value: func(s *MetricSummary) interface{} { return optionalValue(s.Change) }},
+	{name: "change_pct", title: "Change %", value: func(s *MetricSummary) interface{} { return optionalValue(s.ChangePct) }, unitless: true},
+}
+
+// The default statistics of the outputs.
+var (
+	csvStatistics      = []string{"total", "max", "min", "mean", "median", "modes", "range", "excluded"}
+	htmlStatistics     = []string{"total", "max", "min", "mean", "median", "range", "excluded"}
+	markdownStatistics = []string{"total", "mean"}
+	tableStatistics    = []string{"total"}
+	xlsxStatistics     = []string{"total", "max", "min", "mean", "median"}
+)
+
+func optionalValue(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// validateStatistics returns an error when a statistic is not supported.
+func validateStatistics(names []string) error {
+	for _, name := range names {
+		if lookupStatistic(name) == nil {
+			return fmt.Errorf("statistic is unsupported: %s, supported: %s", name, statisticNames())
+		}
+	}
+	return nil
+}
+
+func lookupStatistic(name string) *summaryStatistic {
+	for _, s := range summaryStatistics {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// selectStatistics returns the statistics with the provided names, or the
+// defaults when no names are provided.
+func selectStatistics(names, defaults []string) []*summaryStatistic {
+	if len(names) == 0 {
+		names = defaults
+	}
+	stats := []*summaryStatistic{}
+	for _, name := range names {
+		if s := lookupStatistic(name); s != nil {
+			stats = append(stats, s)
+		}
+	}
+	return stats
+}
+
+// text returns the value of the statistic formatted for tabular outputs.
+// When the number format is empty, the numbers are rounded to two decimal
+// places and have no trailing zeros.
+func (st *summaryStatistic) text(s *MetricSummary, numberFormat string) string {
+	switch v := st.value(s).(type) {
+	case float64:
+		if numberFormat == "" {
+			return formatValue(math.Round(v*100) / 100)
+		}
+		return fmt.Sprintf(numberFormat, v)
+	case int:
+		return fmt.Sprintf("%d", v)
+	case []float64:
+		return fmt.Sprintf("%v", v)
+	}
+	return "-"
+}
+
+// percentile returns the percentile of the sorted values, interpolating
+// between the closest ranks, as PERCENTILE.INC function of Excel does.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// extendStatistics adds the statistics beyond the ones of the calculator
+// to the summary.
+func extendStatistics(summary *MetricSummary, points []*MetricPoint, values []float64) {
+	for _, p := range points {
+		if p.Error != "" {
+			summary.Missing++
+		}
+		if p.Filled {
+			summary.Filled++
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	summary.P50 = percentile(sorted, 0.5)
+	summary.P90 = percentile(sorted, 0.9)
+	summary.P95 = percentile(sorted, 0.95)
+	summary.P99 = percentile(sorted, 0.99)
+	if summary.Mean != 0 {
+		cv := summary.StdDev / summary.Mean
+		summary.CV = &cv
+	}
+	first, last := values[0], values[len(values)-1]
+	change := last - first
+	summary.First, summary.Last, summary.Change = &first, &last, &change
+	if first != 0 {
+		pct := change * 100 / first
+		summary.ChangePct = &pct
+	}
+}
+
+// statisticNames returns the names of the supported statistics.
+func statisticNames() string {
+	names := []string{}
+	for _, s := range summaryStatistics {
+		names = append(names, s.name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,71 @@
+package esqrunner
+
+import (
+	"encoding/csv"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSummaryStatistics(t *testing.T) {
+	points := []*MetricPoint{}
+	for _, v := range []float64{40, 10, 20, 30} {
+		v := v
+		points = append(points, &MetricPoint{Value: &v})
+	}
+	points = append(points, &MetricPoint{Error: "timeout"})
+	s := summarize(points)
+	if s.Total != 100 || s.Mean != 25 || s.Valid != 4 || s.Missing != 1 || s.Excluded != 1 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	if s.Variance != 125 || math.Abs(s.StdDev-math.Sqrt(125)) > 1e-9 || math.Abs(*s.CV-math.Sqrt(125)/25) > 1e-9 {
+		t.Fatalf("unexpected variance or deviation: %+v", s)
+	}
+	if s.P50 != 25 || s.P90 != 37 || math.Abs(s.P99-39.7) > 1e-9 {
+		t.Fatalf("unexpected percentiles: %v %v %v", s.P50, s.P90, s.P99)
+	}
+	if *s.First != 40 || *s.Last != 30 || *s.Change != -10 || *s.ChangePct != -25 {
+		t.Fatalf("unexpected change: %v %v %v %v", *s.First, *s.Last, *s.Change, *s.ChangePct)
+	}
+
+	s = summarize([]*MetricPoint{{Error: "timeout"}})
+	if s.First != nil || s.CV != nil || s.ChangePct != nil || s.Total != 0 || len(s.Modes) != 0 {
+		t.Fatalf("unexpected summary without values: %+v", s)
+	}
+}
+
+func TestOutputStatistics(t *testing.T) {
+	r := newTestOutputRunner(t)
+	r.Config.Output.Format = "csv"
+	r.Config.Output.Landscape = true
+	r.Config.Output.Statistics = []string{"p50", "valid", "missing", "change_pct"}
+	out, err := r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := csv.NewReader(strings.NewReader(out))
+	cr.Comma = ';'
+	records, err := cr.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := strings.Join(records[0][5:], ",")
+	row := strings.Join(records[1][5:], ",")
+	if header != "P50,Valid,Missing,Change %,Metric ID" || !strings.HasPrefix(row, "20.00,2,1,200.00,") {
+		t.Fatalf("unexpected statistics:\n%s", out)
+	}
+
+	r.Config.Output.Format = "markdown"
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "| P50 | Valid | Missing | Change % | Trend |") {
+		t.Fatalf("unexpected markdown statistics:\n%s", out)
+	}
+
+	r.Config.Output.Statistics = []string{"p42"}
+	if err := validateStatistics(r.Config.Output.Statistics); err == nil {
+		t.Fatalf("expected unsupported statistic to fail validation")
+	}
+}
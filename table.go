@@ -0,0 +1,262 @@
+package esqrunner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiBold   = "\x1b[1m"
+	ansiReset  = "\x1b[0m"
+)
+
+// tableCell is a cell of a terminal table. The color is not counted in the
+// width of the cell.
+type tableCell struct {
+	text  string
+	color string
+	left  bool
+}
+
+func (c tableCell) render(width int, colored bool) string {
+	text := truncateText(c.text, width)
+	pad := strings.Repeat(" ", width-utf8.RuneCountInString(text))
+	if colored && c.color != "" {
+		text = c.color + text + ansiReset
+	}
+	if c.left {
+		return text + pad
+	}
+	return pad + text
+}
+
+// truncateText shortens the text to the provided number of characters.
+func truncateText(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n < 2 {
+		return string([]rune(s)[:n])
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// lastRunes returns the last n characters of the text.
+func lastRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[len(runes)-n:])
+}
+
+// outputTable writes metric data as aligned table for terminals. When the
+// table does not fit the width of the terminal, the sparklines are shortened
+// to the latest values or dropped, the metric names are truncated, the
+// columns of the statistics are dropped, and the earliest periods are
+// hidden. The subtotals are in bold.
+func (r *QueryRunner) outputTable(w io.Writer, opts *renderOptions) error {
+	report := r.report(opts.Transforms)
+	results, pivot, err := opts.groupedRows(report)
+	if err != nil {
+		return err
+	}
+	if pivot != nil {
+		_, err := io.WriteString(w, tablePivot(pivot, r.Config.Output.Color))
+		return err
+	}
+	width := r.Config.Output.Width
+	if width <= 0 {
+		width = 120
+	}
+	colored := r.Config.Output.Color
+	const sep = "  "
+
+	nameWidth := len("Metric")
+	for _, m := range results {
+		if n := utf8.RuneCountInString(m.Name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	if nameWidth > 40 {
+		nameWidth = 40
+	}
+
+	type column struct {
+		header tableCell
+		cells  []tableCell
+		width  int
+	}
+	newColumn := func(header string, left bool) *column {
+		return &column{header: tableCell{text: header, left: left}, width: utf8.RuneCountInString(header)}
+	}
+	add := func(c *column, cell tableCell) {
+		c.cells = append(c.cells, cell)
+		if n := utf8.RuneCountInString(cell.text); n > c.width {
+			c.width = n
+		}
+	}
+
+	periods := []*column{}
+	for _, p := range report.Periods {
+		periods = append(periods, newColumn(p.Start.Format("01/02"), false))
+	}
+	stats := selectStatistics(opts.Statistics, tableStatistics)
+	statColumns := []*column{}
+	for _, st := range stats {
+		statColumns = append(statColumns, newColumn(st.title, false))
+	}
+	delta := newColumn("Change", false)
+	trend := newColumn("Trend", true)
+	for _, m := range results {
+		metric := m.Metric()
+		for i, p := range m.Points {
+			if p.Value == nil {
+				add(periods[i], tableCell{text: "ERR", color: ansiRed})
+				continue
+			}
+			if p.Anomaly != nil {
+				add(periods[i], tableCell{text: metric.formatUnit(*p.Value, "") + "!", color: ansiYellow})
+				continue
+			}
+			add(periods[i], tableCell{text: metric.formatUnit(*p.Value, "")})
+		}
+		for i, st := range stats {
+			add(statColumns[i], tableCell{text: metric.statisticText(st, m.Summary, "", true)})
+		}
+		add(delta, tableDelta(m))
+		add(trend, tableCell{text: sparkline(m), left: true})
+	}
+
+	fixed := append(statColumns, delta, trend)
+	used := nameWidth
+	for _, c := range fixed {
+		used += len(sep) + c.width
+	}
+	if over := used - width; over > 0 {
+		if trend.width-over >= utf8.RuneCountInString(trend.header.text) {
+			trend.width -= over
+			for i, c := range trend.cells {
+				trend.cells[i].text = lastRunes(c.text, trend.width)
+			}
+			used -= over
+		} else {
+			fixed = fixed[:len(fixed)-1]
+			used -= len(sep) + trend.width
+		}
+	}
+	if used > width && nameWidth > 12 {
+		shrink := used - width
+		if nameWidth-shrink < 12 {
+			shrink = nameWidth - 12
+		}
+		nameWidth -= shrink
+		used -= shrink
+	}
+	for used > width && len(fixed) > 0 {
+		used -= len(sep) + fixed[len(fixed)-1].width
+		fixed = fixed[:len(fixed)-1]
+	}
+	if used > width {
+		nameWidth = width
+		used = width
+	}
+	// The latest periods are kept, the earliest are hidden.
+	first := len(periods)
+	for first > 0 && used+len(sep)+periods[first-1].width <= width {
+		first--
+		used += len(sep) + periods[first].width
+	}
+
+	var sb strings.Builder
+	if first > 0 {
+		sb.WriteString(truncateText(fmt.Sprintf("%d earlier periods hidden to fit terminal width", first), width) + "\n")
+	}
+	columns := append(append([]*column{}, periods[first:]...), fixed...)
+	line := []string{tableCell{text: "Metric", left: true}.render(nameWidth, false)}
+	for _, c := range columns {
+		line = append(line, c.header.render(c.width, false))
+	}
+	header := strings.TrimRight(strings.Join(line, sep), " ")
+	if colored {
+		header = ansiBold + header + ansiReset
+	}
+	sb.WriteString(header + "\n")
+	for i, m := range results {
+		name := tableCell{text: truncateText(m.Name, nameWidth), left: true}
+		if m.Subtotal() {
+			name.color = ansiBold
+		}
+		line := []string{name.render(nameWidth, colored)}
+		for _, c := range columns {
+			line = append(line, c.cells[i].render(c.width, colored))
+		}
+		sb.WriteString(strings.TrimRight(strings.Join(line, sep), " ") + "\n")
+	}
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// tablePivot returns a pivot table as aligned table for terminals.
+func tablePivot(table *pivotTable, colored bool) string {
+	const sep = "  "
+	rows := [][]tableCell{{{text: table.Title, left: true}}}
+	for _, c := range table.Columns {
+		rows[0] = append(rows[0], tableCell{text: c})
+	}
+	for _, row := range table.Rows {
+		line := []tableCell{{text: row.Name, left: true}}
+		for i, v := range row.Values {
+			line = append(line, tableCell{text: pivotText(row.Metrics[i], v)})
+		}
+		rows = append(rows, line)
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, c := range row {
+			if n := utf8.RuneCountInString(c.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	var sb strings.Builder
+	for i, row := range rows {
+		line := []string{}
+		for j, c := range row {
+			line = append(line, c.render(widths[j], colored))
+		}
+		text := strings.TrimRight(strings.Join(line, sep), " ")
+		if i == 0 && colored {
+			text = ansiBold + text + ansiReset
+		}
+		sb.WriteString(text + "\n")
+	}
+	return sb.String()
+}
+
+// tableDelta returns the change between the last two valid values of
+// a metric, green when it increased and red when it decreased.
+func tableDelta(m *MetricResult) tableCell {
+	values := []float64{}
+	for _, p := range m.Points {
+		if p.Value != nil {
+			values = append(values, *p.Value)
+		}
+	}
+	if len(values) < 2 {
+		return tableCell{text: "-"}
+	}
+	prev, last := values[len(values)-2], values[len(values)-1]
+	switch {
+	case last > prev:
+		return tableCell{text: "+" + m.Metric().formatUnit(last-prev, ""), color: ansiGreen}
+	case last < prev:
+		return tableCell{text: "-" + m.Metric().formatUnit(prev-last, ""), color: ansiRed}
+	}
+	return tableCell{text: "0"}
+}
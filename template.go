@@ -0,0 +1,194 @@
+package esqrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the helper functions available in output templates.
+var templateFuncs = template.FuncMap{
+	// Statistics over the valid values of data points.
+	"values": templateValues,
+	"filled": templateFilled,
+	"count":  func(v []float64) int { return len(v) },
+	"sum":    templateSum,
+	"avg": func(v []float64) float64 {
+		if len(v) == 0 {
+			return 0
+		}
+		return templateSum(v) / float64(len(v))
+	},
+	"min": func(v []float64) float64 {
+		if len(v) == 0 {
+			return 0
+		}
+		return templateSorted(v)[0]
+	},
+	"max": func(v []float64) float64 {
+		if len(v) == 0 {
+			return 0
+		}
+		return templateSorted(v)[len(v)-1]
+	},
+	"median": func(v []float64) float64 {
+		if len(v) == 0 {
+			return 0
+		}
+		s := templateSorted(v)
+		if len(s)%2 == 1 {
+			return s[len(s)/2]
+		}
+		return (s[len(s)/2-1] + s[len(s)/2]) / 2
+	},
+	"value": func(p *MetricPoint, missing string) string {
+		if p.Value == nil {
+			return missing
+		}
+		return formatValue(*p.Value)
+	},
+	// Number formatting.
+	"number":  templateNumber,
+	"round":   func(v float64, precision int) string { return strconv.FormatFloat(v, 'f', precision, 64) },
+	"percent": func(v, total float64) string { return templatePercent(v, total) },
+	"unit":    func(m *MetricResult, v float64) string { return m.Metric().formatUnit(v, "") },
+	// Dates.
+	"date": func(layout string, t time.Time) string { return t.Format(layout) },
+	"unix": func(t time.Time) int64 { return t.Unix() },
+	"now":  func() time.Time { return time.Now() },
+	// Metadata lookup.
+	"meta": func(m *MetricResult, key string) string { return m.Metadata[key] },
+	"default": func(fallback, s string) string {
+		if s == "" {
+			return fallback
+		}
+		return s
+	},
+	// Strings and quoting.
+	"join":      strings.Join,
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"title":     strings.Title,
+	"replace":   func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"sqlquote":  func(s string) string { return "'" + strings.Replace(s, "'", "''", -1) + "'" },
+	"csvquote":  func(s string) string { return `"` + strings.Replace(s, `"`, `""`, -1) + `"` },
+	"json":      templateJSON,
+	"add":       func(a, b int) int { return a + b },
+	"sparkline": sparkline,
+}
+
+// templateValues returns the collected values of the points. The filled
+// values are left out, as the summary statistics leave them out.
+func templateValues(points []*MetricPoint) []float64 {
+	values, _ := validValues(points)
+	return values
+}
+
+// templateFilled returns the values of the points filled according to the
+// missing data policy.
+func templateFilled(points []*MetricPoint) []float64 {
+	values := []float64{}
+	for _, p := range points {
+		if p.Value != nil && p.Filled {
+			values = append(values, *p.Value)
+		}
+	}
+	return values
+}
+
+func templateSum(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	return sum
+}
+
+func templateSorted(v []float64) []float64 {
+	s := append([]float64{}, v...)
+	sort.Float64s(s)
+	return s
+}
+
+// templateNumber returns the number with thousands separators, e.g.
+// 1,234,567.89.
+func templateNumber(v interface{}, precision int) string {
+	var f float64
+	switch n := v.(type) {
+	case uint64:
+		f = float64(n)
+	case *float64:
+		if n == nil {
+			return ""
+		}
+		f = *n
+	case int:
+		f = float64(n)
+	case float64:
+		f = n
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+	s := strconv.FormatFloat(math.Abs(f), 'f', precision, 64)
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i:]
+	}
+	var b strings.Builder
+	if f < 0 {
+		b.WriteByte('-')
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String() + fracPart
+}
+
+func templatePercent(v, total float64) string {
+	if total == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(v*100/total, 'f', 2, 64) + "%"
+}
+
+func templateJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parseOutputTemplate parses template file.
+func parseOutputTemplate(fp string) (*template.Template, error) {
+	content, err := readFileBytes(fp)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading output template %s: %s", fp, err)
+	}
+	tmpl, err := template.New(filepath.Base(fp)).Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing output template %s: %s", fp, err)
+	}
+	return tmpl, nil
+}
+
+// outputTemplate renders the report of a run through the template. The
+// template receives Report, and the fields of the report are available
+// at the top level, e.g. {{ range .Metrics }}.
+func (r *QueryRunner) outputTemplate(w io.Writer, opts *renderOptions) error {
+	tmpl, err := parseOutputTemplate(opts.Template)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, r.report(opts.Transforms))
+}
@@ -0,0 +1,262 @@
+package esqrunner
+
+import (
+	"fmt"
+	"math"
+)
+
+// The exit codes of the runs where the threshold rules fired. The code 1 is
+// reserved for the errors.
+const (
+	ExitOK       = 0
+	ExitWarning  = 3
+	ExitCritical = 4
+)
+
+// The levels of the threshold rules, in the order of severity.
+const (
+	LevelOK       = "ok"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+var thresholdLevels = map[string]int{
+	LevelOK:       0,
+	LevelWarning:  1,
+	LevelCritical: 2,
+}
+
+// ThresholdRule is a rule comparing a value of a metric with warning and
+// critical levels. The value is one of:
+//
+// - last: the last value of the series, the default
+// - any: every value of the series, i.e. the rule fires when any value
+// crosses the level
+// - pct_change: the percent change of the last value from the previous
+// value, or from the value of the compared period when comparing
+// - the name of a summary statistic, e.g. mean or p95
+//
+// The operator is one of >, the default, >=, < or <=, and the rule fires
+// when the value compared with the level using the operator is true.
+type ThresholdRule struct {
+	Name     string   `json:"name,omitempty" yaml:"name"`
+	On       string   `json:"on,omitempty" yaml:"on"`
+	Operator string   `json:"operator,omitempty" yaml:"operator"`
+	Warning  *float64 `json:"warning,omitempty" yaml:"warning"`
+	Critical *float64 `json:"critical,omitempty" yaml:"critical"`
+}
+
+// Validate validates ThresholdRule.
+func (t *ThresholdRule) Validate() error {
+	if t.On == "" {
+		t.On = "last"
+	}
+	switch t.On {
+	case "last", "any", "pct_change":
+	default:
+		if st := lookupStatistic(t.On); st == nil || st.name == "modes" {
+			return fmt.Errorf("threshold value is unsupported: %s", t.On)
+		}
+	}
+	if t.Operator == "" {
+		t.Operator = ">"
+	}
+	switch t.Operator {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("threshold operator is unsupported: %s", t.Operator)
+	}
+	if t.Warning == nil && t.Critical == nil {
+		return fmt.Errorf("threshold has no warning and critical levels")
+	}
+	return nil
+}
+
+// fires returns true when the value crosses the level.
+func (t *ThresholdRule) fires(v float64, level *float64) bool {
+	if level == nil {
+		return false
+	}
+	switch t.Operator {
+	case ">=":
+		return v >= *level
+	case "<":
+		return v < *level
+	case "<=":
+		return v <= *level
+	}
+	return v > *level
+}
+
+// String returns the description of the rule, e.g. last > 5.
+func (t *ThresholdRule) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	s := t.On
+	if t.Warning != nil {
+		s += fmt.Sprintf(" %s %s (warning)", t.Operator, formatValue(*t.Warning))
+	}
+	if t.Critical != nil {
+		s += fmt.Sprintf(" %s %s (critical)", t.Operator, formatValue(*t.Critical))
+	}
+	return s
+}
+
+// ReportEvaluation holds the results of the threshold rules of the metrics.
+// The status is the highest level of the results.
+type ReportEvaluation struct {
+	Status  string             `json:"status"`
+	Results []*ThresholdResult `json:"results"`
+}
+
+// ThresholdResult is the outcome of a threshold rule of a metric. The value
+// is nil when the metric has no value to compare, e.g. no valid points.
+type ThresholdResult struct {
+	MetricID string         `json:"metric_id"`
+	Category string         `json:"category"`
+	Name     string         `json:"name"`
+	Rule     *ThresholdRule `json:"rule"`
+	Level    string         `json:"level"`
+	Value    *float64       `json:"value"`
+	Limit    *float64       `json:"limit,omitempty"`
+	Period   *ReportPeriod  `json:"period,omitempty"`
+}
+
+// Fired returns the results at warning or critical level.
+func (e *ReportEvaluation) Fired() []*ThresholdResult {
+	results := []*ThresholdResult{}
+	for _, res := range e.Results {
+		if res.Level != LevelOK {
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// ExitCode returns the exit code of the process for the status.
+func (e *ReportEvaluation) ExitCode() int {
+	if e == nil {
+		return ExitOK
+	}
+	switch e.Status {
+	case LevelCritical:
+		return ExitCritical
+	case LevelWarning:
+		return ExitWarning
+	}
+	return ExitOK
+}
+
+// evaluate evaluates the threshold rules and the burn rate alerts of the
+// metrics of the report. The report has no evaluation when no metric has
+// threshold rules or burn rate alerts.
+func evaluate(report *Report) *ReportEvaluation {
+	var evaluation *ReportEvaluation
+	for _, result := range report.Metrics {
+		m := result.Metric()
+		if m == nil {
+			continue
+		}
+		results := []*ThresholdResult{}
+		for _, rule := range m.Thresholds {
+			results = append(results, evaluateRule(result, rule))
+		}
+		results = append(results, burnRateResults(result)...)
+		if len(results) == 0 {
+			continue
+		}
+		if evaluation == nil {
+			evaluation = &ReportEvaluation{Status: LevelOK, Results: []*ThresholdResult{}}
+		}
+		for _, res := range results {
+			if thresholdLevels[res.Level] > thresholdLevels[evaluation.Status] {
+				evaluation.Status = res.Level
+			}
+			evaluation.Results = append(evaluation.Results, res)
+		}
+	}
+	return evaluation
+}
+
+// evaluateRule returns the outcome of a threshold rule of a metric. With
+// any value, the value farthest in the direction of the operator is
+// compared.
+func evaluateRule(result *MetricResult, rule *ThresholdRule) *ThresholdResult {
+	res := &ThresholdResult{
+		MetricID: result.ID,
+		Category: result.Category,
+		Name:     result.Name,
+		Rule:     rule,
+		Level:    LevelOK,
+	}
+	switch rule.On {
+	case "last":
+		for _, p := range result.Points {
+			if p.Value != nil {
+				res.Value, res.Period = p.Value, p.Period
+			}
+		}
+	case "any":
+		below := rule.Operator == "<" || rule.Operator == "<="
+		for _, p := range result.Points {
+			if p.Value == nil {
+				continue
+			}
+			if res.Value == nil || (below && *p.Value < *res.Value) || (!below && *p.Value > *res.Value) {
+				res.Value, res.Period = p.Value, p.Period
+			}
+		}
+	case "pct_change":
+		res.Value, res.Period = lastPercentChange(result.Points)
+	default:
+		res.Value = statisticNumber(lookupStatistic(rule.On), result.Summary)
+	}
+	if res.Value == nil || math.IsNaN(*res.Value) {
+		return res
+	}
+	switch {
+	case rule.fires(*res.Value, rule.Critical):
+		res.Level, res.Limit = LevelCritical, rule.Critical
+	case rule.fires(*res.Value, rule.Warning):
+		res.Level, res.Limit = LevelWarning, rule.Warning
+	}
+	return res
+}
+
+// lastPercentChange returns the percent change of the last value, from the
+// value of the compared period when the point has one, or from the previous
+// value otherwise.
+func lastPercentChange(points []*MetricPoint) (*float64, *ReportPeriod) {
+	var prev, last *MetricPoint
+	for _, p := range points {
+		if p.Value == nil {
+			continue
+		}
+		prev, last = last, p
+	}
+	if last == nil {
+		return nil, nil
+	}
+	if last.Compare != nil {
+		return last.Compare.DeltaPct, last.Period
+	}
+	if prev == nil {
+		return nil, last.Period
+	}
+	_, pct := delta(prev.Value, last.Value)
+	return pct, last.Period
+}
+
+// validateThresholds validates the threshold rules of a metric.
+func validateThresholds(rules []*ThresholdRule) error {
+	for i, t := range rules {
+		if t == nil {
+			return fmt.Errorf("threshold %d is empty", i)
+		}
+		if err := t.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package esqrunner
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestThresholds(t *testing.T) {
+	level := func(v float64) *float64 { return &v }
+	testcases := []struct {
+		name     string
+		rules    []*ThresholdRule
+		status   string
+		exitCode int
+		levels   []string
+	}{
+		{
+			name:     "no rules fire",
+			rules:    []*ThresholdRule{{Warning: level(40), Critical: level(50)}},
+			status:   LevelOK,
+			exitCode: ExitOK,
+			levels:   []string{LevelOK},
+		},
+		{
+			name: "last value warning",
+			rules: []*ThresholdRule{
+				{On: "last", Operator: ">=", Warning: level(30), Critical: level(50)},
+				{On: "any", Operator: "<", Critical: level(5)},
+			},
+			status:   LevelWarning,
+			exitCode: ExitWarning,
+			levels:   []string{LevelWarning, LevelOK},
+		},
+		{
+			name: "statistic and percent change critical",
+			rules: []*ThresholdRule{
+				{On: "mean", Warning: level(15)},
+				{On: "pct_change", Warning: level(50), Critical: level(100)},
+			},
+			status:   LevelCritical,
+			exitCode: ExitCritical,
+			levels:   []string{LevelWarning, LevelCritical},
+		},
+	}
+	for _, tc := range testcases {
+		r := newTestOutputRunner(t)
+		r.Config.Metrics[0].Thresholds = tc.rules
+		if err := validateThresholds(tc.rules); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		evaluation := r.Report().Evaluation
+		if evaluation.Status != tc.status || evaluation.ExitCode() != tc.exitCode {
+			t.Fatalf("%s: unexpected evaluation: %s, exit code %d", tc.name, evaluation.Status, evaluation.ExitCode())
+		}
+		for i, res := range evaluation.Results {
+			if res.Level != tc.levels[i] {
+				t.Fatalf("%s: unexpected level of rule %s: %s, value %v", tc.name, res.Rule, res.Level, *res.Value)
+			}
+		}
+		if len(evaluation.Fired()) != len(tc.levels)-strings.Count(strings.Join(tc.levels, ","), LevelOK) {
+			t.Fatalf("%s: unexpected fired rules: %v", tc.name, evaluation.Fired())
+		}
+	}
+
+	r := newTestOutputRunner(t)
+	if r.Report().Evaluation.ExitCode() != ExitOK {
+		t.Fatalf("expected no evaluation without rules")
+	}
+	r.Config.Metrics[0].Thresholds = []*ThresholdRule{{On: "p95", Critical: level(20)}}
+	r.Config.Output.Format = "json"
+	out, err := r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal([]byte(out), report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Evaluation == nil || report.Evaluation.Status != LevelCritical || *report.Evaluation.Results[0].Limit != 20 {
+		t.Fatalf("unexpected evaluation:\n%s", out)
+	}
+	r.Config.Output.Format = "markdown"
+	if out, err = r.Output(); err != nil || !strings.Contains(out, "**Evaluation: critical**") {
+		t.Fatalf("markdown output has no evaluation: %v\n%s", err, out)
+	}
+	r.Config.Output.Format = "html"
+	if out, err = r.Output(); err != nil || !strings.Contains(out, `<tr class="critical">`) {
+		t.Fatalf("html output has no evaluation: %v\n%s", err, out)
+	}
+
+	for _, rule := range []*ThresholdRule{
+		{Warning: level(1), Operator: "!="},
+		{On: "modes", Warning: level(1)},
+		{On: "p42", Warning: level(1)},
+		{On: "last"},
+	} {
+		if err := rule.Validate(); err == nil {
+			t.Fatalf("expected rule %+v to fail validation", rule)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package esqrunner
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// TransformConfig is a transformation of the series of a metric, applied
+// after the missing values are filled. A transformation is one of:
+//
+// - rollup: aggregates the periods into calendar weeks, starting on
+// Monday, months, or quarters, with sum, avg, max, or last aggregate
+// - moving_average: replaces the values with the average of the values in
+// the trailing window of the provided number of periods
+// - cumulative_sum: replaces the values with the running total
+// - rate: divides the values by the days they accumulate, i.e. the days
+// with values of the sum rollups, and a single day otherwise, in days or
+// hours
+type TransformConfig struct {
+	Rollup        string `json:"rollup,omitempty" yaml:"rollup"`
+	Aggregate     string `json:"aggregate,omitempty" yaml:"aggregate"`
+	MovingAverage int    `json:"moving_average,omitempty" yaml:"moving_average"`
+	CumulativeSum bool   `json:"cumulative_sum,omitempty" yaml:"cumulative_sum"`
+	Rate          string `json:"rate,omitempty" yaml:"rate"`
+}
+
+// Validate validates TransformConfig.
+func (t *TransformConfig) Validate() error {
+	n := 0
+	if t.Rollup != "" {
+		n++
+		switch t.Rollup {
+		case "week", "month", "quarter":
+		default:
+			return fmt.Errorf("transform rollup is unsupported: %s", t.Rollup)
+		}
+		switch t.Aggregate {
+		case "":
+			t.Aggregate = "sum"
+		case "sum", "avg", "max", "last":
+		default:
+			return fmt.Errorf("transform aggregate is unsupported: %s", t.Aggregate)
+		}
+	} else if t.Aggregate != "" {
+		return fmt.Errorf("transform aggregate requires rollup")
+	}
+	if t.MovingAverage != 0 {
+		n++
+		if t.MovingAverage < 1 {
+			return fmt.Errorf("transform moving average window must be positive: %d", t.MovingAverage)
+		}
+	}
+	if t.CumulativeSum {
+		n++
+	}
+	if t.Rate != "" {
+		n++
+		if t.Rate != "day" && t.Rate != "hour" {
+			return fmt.Errorf("transform rate is unsupported: %s", t.Rate)
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("transform must have exactly one transformation, found: %d", n)
+	}
+	return nil
+}
+
+// validateTransforms validates the transformations. The rollups change the
+// periods, and are not allowed in the transformations of a single metric.
+func validateTransforms(transforms []*TransformConfig, rollups bool) error {
+	for i, t := range transforms {
+		if t == nil {
+			return fmt.Errorf("transform %d is empty", i)
+		}
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		if t.Rollup != "" && !rollups {
+			return fmt.Errorf("transform rollup is not supported per metric")
+		}
+	}
+	return nil
+}
+
+// transformsOf returns the transformations of a metric: the ones of the
+// metric, the ones of the runner configuration, and the ones of the output
+// being rendered, in this order.
+func (r *QueryRunner) transformsOf(m *Metric, output []*TransformConfig) []*TransformConfig {
+	transforms := []*TransformConfig{}
+	if m != nil {
+		transforms = append(transforms, m.Transforms...)
+	}
+	transforms = append(transforms, r.Config.Transforms...)
+	return append(transforms, output...)
+}
+
+// periods returns the periods of the results, i.e. the days of the
+// timestamps, rolled up according to the transformations of the output.
+func (r *QueryRunner) periods(timestamps []time.Time, output []*TransformConfig) []*ReportPeriod {
+	points := []*MetricPoint{}
+	for _, ts := range timestamps {
+		points = append(points, &MetricPoint{Period: periodOf(ts)})
+	}
+	periods := []*ReportPeriod{}
+	for _, p := range applyTransforms(points, r.transformsOf(nil, output)) {
+		periods = append(periods, p.Period)
+	}
+	return periods
+}
+
+// hasRollup returns true when any of the transformations is a rollup.
+func hasRollup(transforms []*TransformConfig) bool {
+	for _, t := range transforms {
+		if t.Rollup != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTransforms returns the points transformed in order.
+func applyTransforms(points []*MetricPoint, transforms []*TransformConfig) []*MetricPoint {
+	for _, t := range transforms {
+		switch {
+		case t.Rollup != "":
+			points = rollup(points, t.Rollup, t.Aggregate)
+		case t.MovingAverage > 0:
+			points = movingAverage(points, t.MovingAverage)
+		case t.CumulativeSum:
+			points = cumulativeSum(points)
+		case t.Rate != "":
+			points = rate(points, t.Rate)
+		}
+	}
+	return points
+}
+
+// rollupStart returns the start of the calendar period of the time.
+func rollupStart(ts time.Time, unit string) time.Time {
+	day := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+	switch unit {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return day.AddDate(0, 0, 1-day.Day())
+	case "quarter":
+		month := time.Month((int(day.Month())-1)/3*3 + 1)
+		return time.Date(day.Year(), month, 1, 0, 0, 0, 0, day.Location())
+	}
+	return day
+}
+
+// rollup aggregates the points into calendar periods. A period starts at
+// the start of the calendar period and ends after the last of its points,
+// i.e. the periods at the edges of the run are partial. A period has no
+// value when none of its points has a value, and it is filled when all of
+// its values are filled.
+func rollup(points []*MetricPoint, unit, aggregate string) []*MetricPoint {
+	rolled := []*MetricPoint{}
+	var current *MetricPoint
+	var values []float64
+	var filled int
+	flush := func() {
+		if current == nil || len(values) == 0 {
+			return
+		}
+		current.Filled = filled == len(values)
+		var v float64
+		switch aggregate {
+		case "sum", "avg":
+			for _, x := range values {
+				v += x
+			}
+			if aggregate == "avg" {
+				v /= float64(len(values))
+			}
+		case "max":
+			v = values[0]
+			for _, x := range values {
+				if x > v {
+					v = x
+				}
+			}
+		case "last":
+			v = values[len(values)-1]
+		}
+		current.Value = &v
+		current.days = 1
+		if aggregate == "sum" {
+			current.days = len(values)
+		}
+	}
+	for _, p := range points {
+		start := rollupStart(p.Period.Start, unit)
+		if current == nil || !current.Period.Start.Equal(start) {
+			flush()
+			current = &MetricPoint{Period: &ReportPeriod{Start: start, rollup: unit}}
+			values, filled = nil, 0
+			rolled = append(rolled, current)
+		}
+		current.Period.End = p.Period.End
+		if p.Value != nil {
+			values = append(values, *p.Value)
+			if p.Filled {
+				filled++
+			}
+		}
+		if p.Error != "" && current.Error == "" {
+			current.Error = p.Error
+		}
+	}
+	flush()
+	return rolled
+}
+
+// movingAverage replaces the values with the average of the values in the
+// trailing window. The windows at the start of the series are partial.
+func movingAverage(points []*MetricPoint, window int) []*MetricPoint {
+	averaged := []*MetricPoint{}
+	for i, p := range points {
+		q := &MetricPoint{Period: p.Period, Filled: p.Filled, Error: p.Error, days: p.days}
+		var sum float64
+		n := 0
+		for j := i - window + 1; j <= i; j++ {
+			if j >= 0 && points[j].Value != nil {
+				sum += *points[j].Value
+				n++
+			}
+		}
+		if n > 0 {
+			v := sum / float64(n)
+			q.Value = &v
+		}
+		averaged = append(averaged, q)
+	}
+	return averaged
+}
+
+// cumulativeSum replaces the values with the running total. The points
+// without values stay without values.
+func cumulativeSum(points []*MetricPoint) []*MetricPoint {
+	summed := []*MetricPoint{}
+	var total float64
+	for _, p := range points {
+		q := &MetricPoint{Period: p.Period, Filled: p.Filled, Error: p.Error, days: p.days}
+		if p.Value != nil {
+			total += *p.Value
+			v := total
+			q.Value = &v
+		}
+		summed = append(summed, q)
+	}
+	return summed
+}
+
+// rate divides the values by the days they accumulate. The values of the
+// daily periods, and of the rollups other than sum, are of a single day,
+// and the ones of the sum rollups of the days with values, rather than of
+// the whole calendar period.
+func rate(points []*MetricPoint, unit string) []*MetricPoint {
+	rated := []*MetricPoint{}
+	for _, p := range points {
+		q := &MetricPoint{Period: p.Period, Filled: p.Filled, Error: p.Error}
+		if p.Value != nil {
+			d := float64(p.days)
+			if p.days == 0 {
+				d = math.Round(p.Period.End.Sub(p.Period.Start).Hours() / 24)
+			}
+			if unit == "hour" {
+				d *= 24
+			}
+			v := *p.Value / d
+			q.Value = &v
+		}
+		rated = append(rated, q)
+	}
+	return rated
+}
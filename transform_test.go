@@ -0,0 +1,175 @@
+package esqrunner
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTransformPoints(start time.Time, values ...interface{}) []*MetricPoint {
+	points := []*MetricPoint{}
+	for i, v := range values {
+		p := &MetricPoint{Period: periodOf(start.AddDate(0, 0, i))}
+		if f, ok := v.(float64); ok {
+			p.Value = &f
+		} else {
+			p.Error = "timeout"
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+func testTransformValues(points []*MetricPoint) []interface{} {
+	values := []interface{}{}
+	for _, p := range points {
+		if p.Value == nil {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, *p.Value)
+	}
+	return values
+}
+
+func TestTransforms(t *testing.T) {
+	// 2020-02-28 is Friday.
+	start := time.Date(2020, time.February, 28, 0, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		name       string
+		transforms []*TransformConfig
+		values     []interface{}
+		starts     []string
+		ends       []string
+	}{
+		{
+			name:       "weekly sum",
+			transforms: []*TransformConfig{{Rollup: "week"}},
+			values:     []interface{}{30.0, 90.0},
+			starts:     []string{"2020-02-24", "2020-03-02"},
+		},
+		{
+			name:       "monthly max",
+			transforms: []*TransformConfig{{Rollup: "month", Aggregate: "max"}},
+			values:     []interface{}{20.0, 60.0},
+			starts:     []string{"2020-02-01", "2020-03-01"},
+			ends:       []string{"2020-03-01", "2020-03-09"},
+		},
+		{
+			name:       "quarterly last",
+			transforms: []*TransformConfig{{Rollup: "quarter", Aggregate: "last"}},
+			values:     []interface{}{60.0},
+			starts:     []string{"2020-01-01"},
+			ends:       []string{"2020-03-09"},
+		},
+		{
+			name:       "weekly average rate",
+			transforms: []*TransformConfig{{Rollup: "week", Aggregate: "avg"}, {Rate: "day"}},
+			values:     []interface{}{10.0, 30.0},
+		},
+		{
+			name:       "weekly sum rate",
+			transforms: []*TransformConfig{{Rollup: "week"}, {Rate: "day"}},
+			values:     []interface{}{10.0, 30.0},
+		},
+		{
+			name:       "hourly rate",
+			transforms: []*TransformConfig{{Rate: "hour"}},
+			values:     []interface{}{10.0 / 24, 20.0 / 24, 0.0, nil, nil, 30.0 / 24, 0.0, 60.0 / 24, nil, nil},
+		},
+		{
+			name:       "moving average",
+			transforms: []*TransformConfig{{MovingAverage: 2}},
+			values:     []interface{}{10.0, 15.0, 10.0, 0.0, nil, 30.0, 15.0, 30.0, 60.0, nil},
+		},
+		{
+			name:       "cumulative sum",
+			transforms: []*TransformConfig{{CumulativeSum: true}},
+			values:     []interface{}{10.0, 30.0, 30.0, nil, nil, 60.0, 60.0, 120.0, nil, nil},
+		},
+	}
+	for _, tc := range testcases {
+		points := testTransformPoints(start, 10.0, 20.0, 0.0, "err", "err", 30.0, 0.0, 60.0, "err", "err")
+		for _, tr := range tc.transforms {
+			if err := tr.Validate(); err != nil {
+				t.Fatalf("%s: %s", tc.name, err)
+			}
+		}
+		points = applyTransforms(points, tc.transforms)
+		if values := testTransformValues(points); !reflect.DeepEqual(values, tc.values) {
+			t.Fatalf("%s: unexpected values %v, expected %v", tc.name, values, tc.values)
+		}
+		for i, s := range tc.starts {
+			if points[i].Period.Start.Format("2006-01-02") != s {
+				t.Fatalf("%s: unexpected period %d: %v", tc.name, i, points[i].Period)
+			}
+		}
+		for i, s := range tc.ends {
+			if points[i].Period.End.Format("2006-01-02") != s {
+				t.Fatalf("%s: unexpected period %d end: %v", tc.name, i, points[i].Period)
+			}
+		}
+	}
+
+	for _, tr := range []*TransformConfig{
+		{},
+		{Rollup: "year"},
+		{Aggregate: "sum"},
+		{Rollup: "week", MovingAverage: 7},
+		{MovingAverage: -1},
+		{Rate: "minute"},
+	} {
+		if err := tr.Validate(); err == nil {
+			t.Fatalf("expected transform %+v to fail validation", tr)
+		}
+	}
+	if err := validateTransforms([]*TransformConfig{{Rollup: "week"}}, false); err == nil {
+		t.Fatalf("expected rollup per metric to fail validation")
+	}
+}
+
+func TestRollupFilled(t *testing.T) {
+	// 2020-03-02 is Monday.
+	start := time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)
+	points := testTransformPoints(start, 10.0, 20.0, "err", 30.0, 40.0, 50.0, 60.0, 70.0, 80.0)
+	for _, i := range []int{1, 7, 8} {
+		points[i].Filled = true
+	}
+	rolled := rollup(points, "week", "sum")
+	if len(rolled) != 2 || rolled[0].Filled || !rolled[1].Filled {
+		t.Fatalf("rolled periods expected to be filled when all of their values are filled: %v, %v", rolled[0].Filled, rolled[1].Filled)
+	}
+}
+
+func TestOutputTransforms(t *testing.T) {
+	r := newTestOutputRunner(t)
+	r.Config.Metrics[0].Transforms = []*TransformConfig{{CumulativeSum: true}}
+	transforms := []*TransformConfig{{Rollup: "month"}}
+	if err := validateTransforms(transforms, true); err != nil {
+		t.Fatal(err)
+	}
+	report := r.report(transforms)
+	if len(report.Periods) != 1 || len(report.Metrics[0].Points) != 1 || *report.Metrics[0].Points[0].Value != 50 {
+		t.Fatalf("unexpected transformed report: %+v", report.Metrics[0].Points[0])
+	}
+	if end := report.Periods[0].End.Format("2006-01-02"); end != "2020-03-04" {
+		t.Fatalf("unexpected end of the partial month: %s", end)
+	}
+	if len(r.Report().Periods) != 3 {
+		t.Fatalf("output transforms expected to apply while rendering only")
+	}
+
+	// The outputs render with their own transforms.
+	var monthly, daily bytes.Buffer
+	if err := r.render(&monthly, &renderOptions{Format: "csv", Transforms: transforms}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.render(&daily, &renderOptions{Format: "csv"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, m := strings.Count(monthly.String(), "\n"), strings.Count(daily.String(), "\n"); n != 2 || m != 4 {
+		t.Fatalf("unexpected rows of the outputs: %d and %d\n%s\n%s", n, m, monthly.String(), daily.String())
+	}
+}
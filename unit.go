@@ -0,0 +1,217 @@
+package esqrunner
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var supportedUnits = map[string]bool{
+	"count":    true,
+	"percent":  true,
+	"bytes":    true,
+	"seconds":  true,
+	"ms":       true,
+	"currency": true,
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// byteMultiples are the binary multiples of the byte values in text
+// outputs.
+var byteMultiples = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+
+// MetricUnit describes the values of a metric: the unit, the currency of
+// currency unit, the scale applied to the collected values, and the number
+// of decimal places in tabular outputs.
+type MetricUnit struct {
+	Name      string  `json:"name,omitempty"`
+	Currency  string  `json:"currency,omitempty"`
+	Scale     float64 `json:"scale"`
+	Precision *int    `json:"precision,omitempty"`
+}
+
+// validUnit validates the unit, the scale and the precision of a metric.
+// The currency defaults to USD with currency unit.
+func (m *Metric) validUnit() error {
+	if m.Unit != "" {
+		if _, supported := supportedUnits[m.Unit]; !supported {
+			return fmt.Errorf(
+				"attribute Unit has unsupported value: %s, metric: %v",
+				m.Unit, *m,
+			)
+		}
+	}
+	if m.Unit == "currency" {
+		if m.Currency == "" {
+			m.Currency = "USD"
+		}
+		if !currencyCode.MatchString(m.Currency) {
+			return fmt.Errorf("attribute Currency must be ISO 4217 code: %s, metric: %v", m.Currency, *m)
+		}
+	} else if m.Currency != "" {
+		return fmt.Errorf("attribute Currency requires currency unit, metric: %v", *m)
+	}
+	if math.IsNaN(m.Scale) || math.IsInf(m.Scale, 0) {
+		return fmt.Errorf("attribute Scale is invalid: %v, metric: %v", m.Scale, *m)
+	}
+	if m.Precision != nil && (*m.Precision < 0 || *m.Precision > 15) {
+		return fmt.Errorf("attribute Precision must be between 0 and 15: %d, metric: %v", *m.Precision, *m)
+	}
+	return nil
+}
+
+// unit returns the description of the values of a metric, or nil when the
+// metric has no unit, scale or precision.
+func (m *Metric) unit() *MetricUnit {
+	if m == nil || (m.Unit == "" && m.Scale == 0 && m.Precision == nil) {
+		return nil
+	}
+	return &MetricUnit{Name: m.Unit, Currency: m.Currency, Scale: m.scale(), Precision: m.Precision}
+}
+
+// scale returns the multiplier of the collected values of a metric, 1 when
+// the metric has no scale.
+func (m *Metric) scale() float64 {
+	if m.Scale == 0 {
+		return 1
+	}
+	return m.Scale
+}
+
+// unitName returns the name of the unit of a metric in tabular outputs, the
+// currency code with currency unit.
+func (m *Metric) unitName() string {
+	if m.Unit == "currency" {
+		return m.Currency
+	}
+	return m.Unit
+}
+
+// formatNumber returns the value with the precision of the metric. Without
+// precision, the value is in the number format, or in the shortest
+// representation when the number format is empty.
+func (m *Metric) formatNumber(v float64, numberFormat string) string {
+	switch {
+	case m != nil && m.Precision != nil:
+		return strconv.FormatFloat(v, 'f', *m.Precision, 64)
+	case numberFormat == "":
+		return formatValue(v)
+	}
+	return fmt.Sprintf(numberFormat, v)
+}
+
+// formatUnit returns the value with the precision and the unit of the
+// metric, e.g. 12.5%, 340 ms or 10.25 USD. The byte values are in binary
+// multiples, e.g. 1.5 MiB, rounded to two decimal places without
+// precision and number format.
+func (m *Metric) formatUnit(v float64, numberFormat string) string {
+	if m == nil {
+		return m.formatNumber(v, numberFormat)
+	}
+	switch m.Unit {
+	case "percent":
+		return m.formatNumber(v, numberFormat) + "%"
+	case "seconds":
+		return m.formatNumber(v, numberFormat) + " s"
+	case "ms":
+		return m.formatNumber(v, numberFormat) + " ms"
+	case "currency":
+		return m.formatNumber(v, numberFormat) + " " + m.Currency
+	case "bytes":
+		i := 0
+		for i < len(byteMultiples)-1 && math.Abs(v) >= 1024 {
+			v /= 1024
+			i++
+		}
+		if i > 0 && m.Precision == nil && numberFormat == "" {
+			v = math.Round(v*100) / 100
+		}
+		return m.formatNumber(v, numberFormat) + " " + byteMultiples[i]
+	}
+	return m.formatNumber(v, numberFormat)
+}
+
+// statisticText returns the value of the statistic of a metric formatted
+// for tabular outputs, with the precision of the metric, and with its unit
+// when requested. The counts and the statistics without the unit of the
+// metric, e.g. variance, are formatted as the statistic does.
+func (m *Metric) statisticText(st *summaryStatistic, s *MetricSummary, numberFormat string, withUnit bool) string {
+	v, ok := st.value(s).(float64)
+	if !ok || st.unitless || m == nil {
+		return st.text(s, numberFormat)
+	}
+	if numberFormat == "" {
+		v = math.Round(v*100) / 100
+	}
+	if withUnit {
+		return m.formatUnit(v, numberFormat)
+	}
+	return m.formatNumber(v, numberFormat)
+}
+
+// xlsxFormat returns the number format code of the values of a metric in
+// XLSX output, or an empty string when the metric has neither a unit
+// shown in the cells nor a precision.
+func (m *Metric) xlsxFormat() string {
+	suffix := ""
+	switch m.Unit {
+	case "percent":
+		suffix = `"%"`
+	case "bytes":
+		suffix = `" B"`
+	case "seconds":
+		suffix = `" s"`
+	case "ms":
+		suffix = `" ms"`
+	case "currency":
+		suffix = `" ` + m.Currency + `"`
+	}
+	if m.Precision == nil {
+		if suffix == "" {
+			return ""
+		}
+		return "General" + suffix
+	}
+	digits := "0"
+	if *m.Precision > 0 {
+		digits += "." + strings.Repeat("0", *m.Precision)
+	}
+	return digits + suffix
+}
+
+// prometheusUnit returns the base unit of a metric in Prometheus outputs,
+// which is the suffix of the metric name, or an empty string when the
+// metric has no unit or counts events.
+func (m *Metric) prometheusUnit() string {
+	switch m.Unit {
+	case "percent", "bytes", "seconds":
+		return m.Unit
+	case "ms":
+		return "seconds"
+	case "currency":
+		return prometheusName(m.Currency)
+	}
+	return ""
+}
+
+// prometheusValue returns the value of a metric in the base unit of
+// Prometheus outputs, i.e. milliseconds are converted to seconds.
+func (m *Metric) prometheusValue(v float64) float64 {
+	if m.Unit == "ms" {
+		return v / 1000
+	}
+	return v
+}
+
+// hasUnits returns true when any metric has a unit.
+func (r *QueryRunner) hasUnits() bool {
+	for _, m := range r.Config.Metrics {
+		if !m.Disabled && m.Unit != "" {
+			return true
+		}
+	}
+	return false
+}
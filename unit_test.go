@@ -0,0 +1,159 @@
+package esqrunner
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMetricUnits(t *testing.T) {
+	precision := func(p int) *int { return &p }
+	testcases := []struct {
+		name     string
+		metric   *Metric
+		value    float64
+		format   string
+		expected string
+		xlsx     string
+	}{
+		{name: "no unit", metric: &Metric{}, value: 10.5, expected: "10.5"},
+		{name: "count with precision", metric: &Metric{Unit: "count", Precision: precision(0)}, value: 10.5, expected: "10", xlsx: "0"},
+		{name: "percent", metric: &Metric{Unit: "percent", Precision: precision(1)}, value: 99.95, expected: "100.0%", xlsx: `0.0"%"`},
+		{name: "milliseconds", metric: &Metric{Unit: "ms"}, value: 340, expected: "340 ms", xlsx: `General" ms"`},
+		{name: "seconds in number format", metric: &Metric{Unit: "seconds"}, value: 1.5, format: "%.2f", expected: "1.50 s", xlsx: `General" s"`},
+		{name: "currency", metric: &Metric{Unit: "currency", Currency: "EUR", Precision: precision(2)}, value: 10.25, expected: "10.25 EUR", xlsx: `0.00" EUR"`},
+		{name: "bytes", metric: &Metric{Unit: "bytes"}, value: 512, expected: "512 B", xlsx: `General" B"`},
+		{name: "kibibytes", metric: &Metric{Unit: "bytes"}, value: 1536, expected: "1.5 KiB", xlsx: `General" B"`},
+		{name: "mebibytes with precision", metric: &Metric{Unit: "bytes", Precision: precision(1)}, value: 3 * 1024 * 1024, expected: "3.0 MiB", xlsx: `0.0" B"`},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if s := tc.metric.formatUnit(tc.value, tc.format); s != tc.expected {
+				t.Fatalf("unexpected value: %s, expected: %s", s, tc.expected)
+			}
+			if s := tc.metric.xlsxFormat(); s != tc.xlsx {
+				t.Fatalf("unexpected xlsx format: %s, expected: %s", s, tc.xlsx)
+			}
+		})
+	}
+
+	invalid := []*Metric{
+		{Unit: "minutes"},
+		{Unit: "currency", Currency: "euro"},
+		{Unit: "count", Currency: "USD"},
+		{Precision: precision(-1)},
+	}
+	for _, m := range invalid {
+		if err := m.validUnit(); err == nil {
+			t.Fatalf("expected error for metric: %v", *m)
+		}
+	}
+	m := &Metric{Unit: "currency"}
+	if err := m.validUnit(); err != nil || m.Currency != "USD" {
+		t.Fatalf("expected default currency: %v, %s", err, m.Currency)
+	}
+}
+
+func TestOutputUnits(t *testing.T) {
+	r := newTestOutputRunner(t)
+	m := r.Config.Metrics[0]
+	precision := 1
+	m.Unit, m.Precision = "ms", &precision
+
+	r.Config.Output.Format = "markdown"
+	out, err := r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "| 10.0 ms | - | 30.0 ms | 40.0 ms | 20.0 ms |") {
+		t.Fatalf("unexpected markdown:\n%s", out)
+	}
+
+	r.Config.Output.Format = "csv"
+	r.Config.Output.Landscape = true
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := csv.NewReader(strings.NewReader(out))
+	cr.Comma = ';'
+	records, err := cr.ReadAll()
+	if err != nil {
+		t.Fatalf("malformed csv: %s\n%s", err, out)
+	}
+	header, row := records[0], records[1]
+	if header[len(header)-2] != "Unit" || row[len(row)-2] != "ms" || row[2] != "10.0" || row[5] != "40.0" {
+		t.Fatalf("unexpected csv:\n%s", out)
+	}
+
+	r.Config.Output.Format = "xlsx"
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(strings.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("malformed xlsx: %s", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	if s := `<numFmt numFmtId="165" formatCode="0.0&#34; ms&#34;"/>`; !strings.Contains(files["xl/styles.xml"], s) {
+		t.Fatalf("styles have no %s:\n%s", s, files["xl/styles.xml"])
+	}
+	for _, s := range []string{`<c r="B2" s="5"><v>10</v></c>`, `<c r="E2" s="5"><f>SUM(B2:D2)</f><v>40</v></c>`} {
+		if !strings.Contains(files["xl/worksheets/sheet2.xml"], s) {
+			t.Fatalf("worksheet has no %s:\n%s", s, files["xl/worksheets/sheet2.xml"])
+		}
+	}
+
+	r.Config.Output.Format = "json"
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal([]byte(out), report); err != nil {
+		t.Fatal(err)
+	}
+	if u := report.Metrics[0].Unit; u == nil || u.Name != "ms" || u.Scale != 1 || u.Precision == nil || *u.Precision != 1 {
+		t.Fatalf("unexpected unit: %s", out)
+	}
+
+	r.Config.Output.Format = "openmetrics"
+	r.Config.Output.Timestamps = true
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"# UNIT esqrunner_helpdesk_ticket_total_seconds seconds\n",
+		"esqrunner_helpdesk_ticket_total_seconds{",
+		"} 0.01 ",
+		"} 0.03 ",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("openmetrics output has no %q:\n%s", s, out)
+		}
+	}
+
+	m.Scale = 2
+	r.Config.Output.Format = "table"
+	out, err = r.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "20.0 ms") || !strings.Contains(out, "60.0 ms") || !strings.Contains(out, "+40.0 ms") {
+		t.Fatalf("unexpected table:\n%s", out)
+	}
+}
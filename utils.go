@@ -1,13 +1,16 @@
 package esqrunner
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 func expandHomePath(fp string) (string, error) {
-	if fp[0] != '~' {
+	if fp == "" || fp[0] != '~' {
 		return fp, nil
 	}
 	hd, err := os.UserHomeDir()
@@ -28,5 +31,40 @@ func readFileBytes(fp string) ([]byte, error) {
 }
 
 func writeToFile(fp string, data string) error {
-	return ioutil.WriteFile(fp, []byte(data), 0644)
+	return writeFileAtomic(fp, []byte(data))
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of the
+// file and renames it, so that readers never see a partially written file.
+func writeFileAtomic(fp string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(fp), "."+filepath.Base(fp)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fp)
+}
+
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
 }
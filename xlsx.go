@@ -0,0 +1,566 @@
+package esqrunner
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The styles of the cells, as indexes of cellXfs in the styles. The styles
+// of the custom number formats follow the base styles.
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDateHeader
+	xlsxStyleDecimal
+	xlsxStyleInteger
+	xlsxStyleCustom
+)
+
+// xlsxNumFmtCustom is the ID of the first custom number format. The format
+// 164 is the date of the headers.
+const xlsxNumFmtCustom = 165
+
+const xlsxStylesHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+`
+
+const xlsxStylesFonts = `<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+`
+
+const xlsxStylesBase = `<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>
+<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+`
+
+const xlsxStylesFooter = `<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+// xlsxNumberFormats are the custom number formats of the cells, e.g. the
+// formats of the metrics with units.
+type xlsxNumberFormats []string
+
+// style returns the style of the cells with the number format, or the
+// fallback style when the format is empty.
+func (f *xlsxNumberFormats) style(format string, fallback int) int {
+	if format == "" {
+		return fallback
+	}
+	for i, existing := range *f {
+		if existing == format {
+			return xlsxStyleCustom + i
+		}
+	}
+	*f = append(*f, format)
+	return xlsxStyleCustom + len(*f) - 1
+}
+
+// xml returns the styles of the workbook: the base styles, and a style per
+// custom number format.
+func (f xlsxNumberFormats) xml() string {
+	var b strings.Builder
+	b.WriteString(xlsxStylesHeader)
+	b.WriteString(fmt.Sprintf(`<numFmts count="%d"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd"/>`, len(f)+1))
+	for i, format := range f {
+		b.WriteString(fmt.Sprintf(`<numFmt numFmtId="%d" formatCode="%s"/>`, xlsxNumFmtCustom+i, xlsxEscape(format)))
+	}
+	b.WriteString("</numFmts>\n")
+	b.WriteString(xlsxStylesFonts)
+	b.WriteString(fmt.Sprintf("<cellXfs count=\"%d\">\n", xlsxStyleCustom+len(f)))
+	b.WriteString(xlsxStylesBase)
+	for i := range f {
+		b.WriteString(fmt.Sprintf(`<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`+"\n", xlsxNumFmtCustom+i))
+	}
+	b.WriteString("</cellXfs>\n")
+	b.WriteString(xlsxStylesFooter)
+	return b.String()
+}
+
+// xlsxCell is a cell of a worksheet. A cell with a formula holds its
+// precomputed value, shown by the viewers not recalculating formulas.
+type xlsxCell struct {
+	text    string
+	number  float64
+	formula string
+	numeric bool
+	empty   bool
+	style   int
+}
+
+func xlsxText(s string, style int) xlsxCell {
+	return xlsxCell{text: s, style: style}
+}
+
+func xlsxNumber(v float64, style int) xlsxCell {
+	return xlsxCell{number: v, numeric: true, style: style}
+}
+
+func xlsxFormula(f string, v float64, style int) xlsxCell {
+	return xlsxCell{formula: f, number: v, numeric: true, style: style}
+}
+
+// xlsxDate returns Excel serial date, i.e. the number of days since
+// 1899-12-30.
+func xlsxDate(ts time.Time) xlsxCell {
+	day := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, time.UTC)
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	return xlsxNumber(float64(day.Sub(epoch)/(24*time.Hour)), xlsxStyleDateHeader)
+}
+
+// xlsxSheet is a worksheet with a header row, which is frozen and has
+// an auto filter.
+type xlsxSheet struct {
+	name   string
+	widths []float64
+	rows   [][]xlsxCell
+}
+
+// xlsxColumn returns the name of the column, e.g. A, Z, AA.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xlsxEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xlsxSheetName returns a valid and unique worksheet name, i.e. without
+// the characters []:*?/\ and up to 31 characters long.
+func xlsxSheetName(s string, used map[string]bool) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.Trim(s, "'"))
+	if s == "" {
+		s = "Sheet"
+	}
+	if runes := []rune(s); len(runes) > 31 {
+		s = string(runes[:31])
+	}
+	name := s
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		runes := []rune(s)
+		if len(runes)+len(suffix) > 31 {
+			runes = runes[:31-len(suffix)]
+		}
+		name = string(runes) + suffix
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+func (s *xlsxSheet) xml() string {
+	var b strings.Builder
+	width := 0
+	for _, row := range s.rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if width == 0 {
+		width = 1
+	}
+	lastCell := fmt.Sprintf("%s%d", xlsxColumn(width-1), len(s.rows))
+	if len(s.rows) == 0 {
+		lastCell = "A1"
+	}
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	b.WriteString(`<dimension ref="A1:` + lastCell + `"/>`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(s.widths) > 0 {
+		b.WriteString("<cols>")
+		for i, w := range s.widths {
+			b.WriteString(fmt.Sprintf(`<col min="%d" max="%d" width="%.1f" customWidth="1"/>`, i+1, i+1, w))
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	for i, row := range s.rows {
+		b.WriteString(fmt.Sprintf(`<row r="%d">`, i+1))
+		for j, c := range row {
+			if c.empty {
+				continue
+			}
+			ref := fmt.Sprintf("%s%d", xlsxColumn(j), i+1)
+			style := ""
+			if c.style != xlsxStyleDefault {
+				style = fmt.Sprintf(` s="%d"`, c.style)
+			}
+			switch {
+			case c.formula != "":
+				b.WriteString(fmt.Sprintf(`<c r="%s"%s><f>%s</f><v>%s</v></c>`, ref, style, xlsxEscape(c.formula), strconv.FormatFloat(c.number, 'f', -1, 64)))
+			case c.numeric:
+				b.WriteString(fmt.Sprintf(`<c r="%s"%s><v>%s</v></c>`, ref, style, strconv.FormatFloat(c.number, 'f', -1, 64)))
+			default:
+				b.WriteString(fmt.Sprintf(`<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xlsxEscape(c.text)))
+			}
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData>")
+	if len(s.rows) > 0 {
+		b.WriteString(`<autoFilter ref="A1:` + lastCell + `"/>`)
+	}
+	b.WriteString("</worksheet>")
+	return b.String()
+}
+
+// writeXLSX writes the worksheets as Office Open XML workbook, with the
+// custom number formats of the cells.
+//
+// References:
+//
+// - [ECMA-376 Office Open XML File Formats](https://ecma-international.org/publications-and-standards/standards/ecma-376/)
+func writeXLSX(w io.Writer, sheets []*xlsxSheet, formats xlsxNumberFormats) error {
+	var contentTypes, workbook, workbookRels, definedNames strings.Builder
+	contentTypes.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	contentTypes.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	contentTypes.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	contentTypes.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+
+	workbookRels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	workbookRels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, s := range sheets {
+		contentTypes.WriteString(fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1))
+		workbook.WriteString(fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(s.name), i+1, i+1))
+		workbookRels.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1))
+		if len(s.rows) > 0 && len(s.rows[0]) > 0 {
+			ref := fmt.Sprintf("$A$1:$%s$%d", xlsxColumn(len(s.rows[0])-1), len(s.rows))
+			definedNames.WriteString(fmt.Sprintf(`<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">'%s'!%s</definedName>`, i, xlsxEscape(strings.Replace(s.name, "'", "''", -1)), ref))
+		}
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets>`)
+	if definedNames.Len() > 0 {
+		workbook.WriteString(`<definedNames>` + definedNames.String() + `</definedNames>`)
+	}
+	workbook.WriteString(`</workbook>`)
+	workbookRels.WriteString(fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1))
+	workbookRels.WriteString(`</Relationships>`)
+
+	files := [][2]string{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", formats.xml()},
+	}
+	for i, s := range sheets {
+		files = append(files, [2]string{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), s.xml()})
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f[0])
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f[1]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// outputXLSX writes metric data as Excel workbook with a summary worksheet
+// and a worksheet per category in landscape layout. The values of the
+// metrics with units or precisions have the number formats of the metrics.
+// The subtotal of a category is the last row of its worksheet, with the sums
+// of the columns of the values. With anomaly detection, the worksheets of
+// the categories have a column of the flagged periods. With pivot, the
+// workbook has the worksheet of the pivot table as well, following the
+// worksheets of the categories. The summary worksheet has the totals of the
+// categories, with the number formats of their metrics, except for the
+// categories with different units or with SLO metrics.
+func (r *QueryRunner) outputXLSX(w io.Writer, opts *renderOptions) error {
+	report := r.report(opts.Transforms)
+	results, pivot, err := opts.groupedRows(report)
+	if err != nil {
+		return err
+	}
+	if pivot != nil {
+		results = opts.Grouping.rows(report.Metrics)
+	}
+	formats := xlsxNumberFormats{}
+	stats := selectStatistics(opts.Statistics, xlsxStatistics)
+	categories := []string{}
+	categoryMetrics := make(map[string][]*MetricResult)
+	for _, m := range results {
+		if _, exists := categoryMetrics[m.Category]; !exists {
+			categories = append(categories, m.Category)
+		}
+		categoryMetrics[m.Category] = append(categoryMetrics[m.Category], m)
+	}
+
+	used := map[string]bool{}
+	summary := &xlsxSheet{name: xlsxSheetName("Summary", used)}
+	sheets := []*xlsxSheet{summary}
+
+	header := []xlsxCell{xlsxText("Category", xlsxStyleHeader), xlsxText("Metrics", xlsxStyleHeader)}
+	for _, p := range report.Periods {
+		header = append(header, xlsxDate(p.Start))
+	}
+	header = append(header, xlsxText("Total", xlsxStyleHeader))
+	summary.rows = append(summary.rows, header)
+	summary.widths = append([]float64{24, 10}, xlsxWidths(len(report.Periods)+1, 12)...)
+
+	for _, category := range categories {
+		metrics := categoryMetrics[category]
+		sheet := &xlsxSheet{name: xlsxSheetName(category, used)}
+		sheets = append(sheets, sheet)
+
+		header := []xlsxCell{xlsxText("Metrics", xlsxStyleHeader)}
+		for _, k := range r.Config.Metadata.FieldList {
+			header = append(header, xlsxText(strings.Title(k), xlsxStyleHeader))
+		}
+		for _, p := range report.Periods {
+			header = append(header, xlsxDate(p.Start))
+		}
+		for _, st := range stats {
+			header = append(header, xlsxText(st.title, xlsxStyleHeader))
+		}
+		if r.hasAnomalyDetection() {
+			header = append(header, xlsxText("Anomalies", xlsxStyleHeader))
+		}
+		header = append(header, xlsxText("Metric ID", xlsxStyleHeader))
+		sheet.rows = append(sheet.rows, header)
+		sheet.widths = append([]float64{40}, xlsxWidths(len(r.Config.Metadata.FieldList), 16)...)
+		sheet.widths = append(sheet.widths, xlsxWidths(len(report.Periods)+len(stats), 12)...)
+		if r.hasAnomalyDetection() {
+			sheet.widths = append(sheet.widths, 40)
+		}
+		sheet.widths = append(sheet.widths, 36)
+
+		first := len(r.Config.Metadata.FieldList) + 1
+		categoryTotals := make([]float64, len(report.Periods))
+		categoryValid := make([]bool, len(report.Periods))
+		unitMetrics := []*Metric{}
+		count := 0
+		for _, m := range metrics {
+			rowNum := len(sheet.rows) + 1
+			if m.Subtotal() {
+				style := formats.style(m.Metric().xlsxFormat(), xlsxStyleDefault)
+				sheet.rows = append(sheet.rows, xlsxSubtotalRow(m, stats, first, rowNum, len(r.Config.Metadata.FieldList), style))
+				continue
+			}
+			count++
+			row := []xlsxCell{xlsxText(m.Name, xlsxStyleDefault)}
+			format := ""
+			if metric := m.Metric(); metric != nil {
+				format = metric.xlsxFormat()
+				unitMetrics = append(unitMetrics, metric)
+			}
+			for _, k := range r.Config.Metadata.FieldList {
+				if v, exists := m.Metadata[k]; exists {
+					row = append(row, xlsxText(v, xlsxStyleDefault))
+				} else {
+					row = append(row, xlsxCell{empty: true})
+				}
+			}
+			for i, p := range m.Points {
+				if p.Value == nil {
+					row = append(row, xlsxCell{empty: true})
+					continue
+				}
+				v := *p.Value
+				categoryTotals[i] += v
+				categoryValid[i] = true
+				row = append(row, xlsxValue(v, format, &formats))
+			}
+			valueRange := xlsxValueRange(m, first, rowNum)
+			for _, st := range stats {
+				row = append(row, xlsxStatistic(st, m.Summary, valueRange, formats.style(format, xlsxStyleDecimal)))
+			}
+			if r.hasAnomalyDetection() {
+				anomalies := []string{}
+				for _, p := range m.Points {
+					if p.Anomaly != nil {
+						anomalies = append(anomalies, p.Period.Start.Format("2006-01-02")+": "+anomalyText(p.Anomaly))
+					}
+				}
+				row = append(row, xlsxText(strings.Join(anomalies, "; "), xlsxStyleDefault))
+			}
+			row = append(row, xlsxText(m.ID, xlsxStyleDefault))
+			sheet.rows = append(sheet.rows, row)
+		}
+
+		// The totals of a category are left blank when its metrics have
+		// different units, or are SLO metrics, as the subtotals are.
+		row := []xlsxCell{xlsxText(category, xlsxStyleDefault), xlsxNumber(float64(count), xlsxStyleInteger)}
+		shared := sharedUnit(unitMetrics)
+		for _, metric := range unitMetrics {
+			if metric.SLO != nil {
+				shared = nil
+			}
+		}
+		if shared == nil || len(unitMetrics) < count {
+			summary.rows = append(summary.rows, row)
+			continue
+		}
+		var total float64
+		for i := range report.Periods {
+			if !categoryValid[i] {
+				row = append(row, xlsxCell{empty: true})
+				continue
+			}
+			total += categoryTotals[i]
+			row = append(row, xlsxValue(categoryTotals[i], shared.xlsxFormat(), &formats))
+		}
+		row = append(row, xlsxValue(total, shared.xlsxFormat(), &formats))
+		summary.rows = append(summary.rows, row)
+	}
+	if pivot != nil {
+		sheets = append(sheets, xlsxPivotSheet(pivot, xlsxSheetName("Pivot", used), &formats))
+	}
+	return writeXLSX(w, sheets, formats)
+}
+
+// xlsxValue returns the cell of a value with the number format of its
+// metric, or the integer or the decimal style when the metric has none.
+func xlsxValue(v float64, format string, formats *xlsxNumberFormats) xlsxCell {
+	switch {
+	case format != "":
+		return xlsxNumber(v, formats.style(format, xlsxStyleDecimal))
+	case v == math.Trunc(v):
+		return xlsxNumber(v, xlsxStyleInteger)
+	default:
+		return xlsxNumber(v, xlsxStyleDecimal)
+	}
+}
+
+// xlsxSubtotalRow returns the row of the subtotal of a category, following
+// the rows of its metrics. The values are the sums of the columns above, in
+// the style of the values of the metrics, or in the integer or the decimal
+// style with the default style.
+func xlsxSubtotalRow(m *MetricResult, stats []*summaryStatistic, first, rowNum, fields, style int) []xlsxCell {
+	row := []xlsxCell{xlsxText(m.Name, xlsxStyleHeader)}
+	for i := 0; i < fields; i++ {
+		row = append(row, xlsxCell{empty: true})
+	}
+	for i, p := range m.Points {
+		if p.Value == nil {
+			row = append(row, xlsxCell{empty: true})
+			continue
+		}
+		column := xlsxColumn(first + i)
+		valueStyle := style
+		if style == xlsxStyleDefault {
+			valueStyle = xlsxStyleDecimal
+			if *p.Value == math.Trunc(*p.Value) {
+				valueStyle = xlsxStyleInteger
+			}
+		}
+		row = append(row, xlsxFormula(fmt.Sprintf("SUM(%s2:%s%d)", column, column, rowNum-1), *p.Value, valueStyle))
+	}
+	if style == xlsxStyleDefault {
+		style = xlsxStyleDecimal
+	}
+	valueRange := xlsxValueRange(m, first, rowNum)
+	for _, st := range stats {
+		row = append(row, xlsxStatistic(st, m.Summary, valueRange, style))
+	}
+	return row
+}
+
+// xlsxValueRange returns the range of the values of a metric in its row, or
+// an empty string when the metric has filled values, which the statistics
+// exclude, and the formulas over the range would not.
+func xlsxValueRange(m *MetricResult, first, rowNum int) string {
+	if m.Summary.Filled > 0 {
+		return ""
+	}
+	if len(m.Points) == 0 {
+		return fmt.Sprintf("%s%d", xlsxColumn(first), rowNum)
+	}
+	return fmt.Sprintf("%s%d:%s%d", xlsxColumn(first), rowNum, xlsxColumn(first+len(m.Points)-1), rowNum)
+}
+
+// xlsxPivotSheet returns the worksheet of a pivot table.
+func xlsxPivotSheet(table *pivotTable, name string, formats *xlsxNumberFormats) *xlsxSheet {
+	sheet := &xlsxSheet{name: name}
+	header := []xlsxCell{xlsxText(table.Title, xlsxStyleHeader)}
+	for _, c := range table.Columns {
+		header = append(header, xlsxText(c, xlsxStyleHeader))
+	}
+	sheet.rows = append(sheet.rows, header)
+	sheet.widths = append([]float64{24}, xlsxWidths(len(table.Columns), 16)...)
+	for _, row := range table.Rows {
+		cells := []xlsxCell{xlsxText(row.Name, xlsxStyleDefault)}
+		for i, v := range row.Values {
+			if v == nil {
+				cells = append(cells, xlsxCell{empty: true})
+				continue
+			}
+			format := ""
+			if m := row.Metrics[i]; m != nil {
+				format = m.xlsxFormat()
+			}
+			cells = append(cells, xlsxNumber(*v, formats.style(format, xlsxStyleDecimal)))
+		}
+		sheet.rows = append(sheet.rows, cells)
+	}
+	return sheet
+}
+
+func xlsxWidths(n int, w float64) []float64 {
+	widths := make([]float64, n)
+	for i := range widths {
+		widths[i] = w
+	}
+	return widths
+}
+
+// xlsxStatistic returns the cell of a summary statistic, with the formula
+// over the range of values when the statistic has one and the range is not
+// empty. The statistics in
+// the unit of the metric have the style of the values.
+func xlsxStatistic(st *summaryStatistic, s *MetricSummary, valueRange string, style int) xlsxCell {
+	if st.unitless {
+		style = xlsxStyleDecimal
+	}
+	switch v := st.value(s).(type) {
+	case float64:
+		if st.excel != "" && valueRange != "" {
+			return xlsxFormula(fmt.Sprintf(st.excel, valueRange), v, style)
+		}
+		return xlsxNumber(v, style)
+	case int:
+		if st.excel != "" && valueRange != "" {
+			return xlsxFormula(fmt.Sprintf(st.excel, valueRange), float64(v), xlsxStyleInteger)
+		}
+		return xlsxNumber(float64(v), xlsxStyleInteger)
+	case []float64:
+		return xlsxText(st.text(s, ""), xlsxStyleDefault)
+	}
+	return xlsxCell{empty: true}
+}